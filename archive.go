@@ -0,0 +1,485 @@
+package everquest
+
+import (
+	"bufio"
+	"compress/gzip"
+	"container/heap"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ArchiveOptions configures ArchiveLog
+type ArchiveOptions struct {
+	SessionGap time.Duration  // Split wherever the log goes quiet for this long instead of by day, 0 splits by day
+	Truncate   bool           // Cut the archived lines from the live log once they have been archived
+	Location   *time.Location // Zone the log was written in, decides where days split, nil for local time
+}
+
+// ArchiveLog splits an eqlog into gzipped archives in dir, one per day or per session, returning the archives written.
+// Archiving into an archive that already exists appends to it, skipping the lines it already holds so a log can be archived again as it grows.
+// A last line without its newline is still being written and is left for next time.
+// With Truncate set the archived lines are cut from the live log and anything written after them while archiving is kept,
+// only a line written in the moment between copying that tail and truncating can be lost, so archive with the game closed when possible.
+func ArchiveLog(path, dir string, opts ArchiveOptions) ([]string, error) {
+	base := strings.TrimSuffix(filepath.Base(path), ".txt")
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	var written []string
+	var current *archiveWriter
+	var last time.Time
+	var archived int64 // offset just past the last complete line read
+	reader := bufio.NewReader(file)
+	parser := NewLogLineParser(opts.Location)
+	for {
+		line, readErr := reader.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			return written, readErr
+		}
+		if !strings.HasSuffix(line, "\n") { // nothing left, or a line still being written
+			break
+		}
+		archived += int64(len(line))
+		log, perr := parser.Parse(strings.TrimRight(line, "\r\n"))
+		if perr == nil {
+			newChunk := current == nil
+			if opts.SessionGap > 0 {
+				newChunk = newChunk || log.T.Sub(last) >= opts.SessionGap
+			} else {
+				newChunk = newChunk || !sameDay(log.T, last)
+			}
+			if newChunk {
+				if current != nil {
+					if err := current.Close(); err != nil {
+						return written, err
+					}
+				}
+				name := base + "_" + log.T.Format("20060102") + ".txt.gz"
+				if opts.SessionGap > 0 {
+					name = base + "_" + log.T.Format("20060102-150405") + ".txt.gz"
+				}
+				current, err = openArchiveWriter(filepath.Join(dir, name), opts.Location)
+				if err != nil {
+					return written, err
+				}
+			}
+			last = log.T
+		} else {
+			log = nil
+		}
+		if current != nil { // lines before the first timestamp have nowhere to go
+			wrote, err := current.WriteLine(line, log)
+			if err != nil {
+				return written, err
+			}
+			if wrote && (len(written) == 0 || written[len(written)-1] != current.path) {
+				written = append(written, current.path)
+			}
+		}
+	}
+	if current != nil {
+		if err := current.Close(); err != nil {
+			return written, err
+		}
+	}
+
+	if opts.Truncate {
+		if err := cutLogHead(path, archived); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// cutLogHead removes the first n bytes of the log at path, keeping whatever follows them
+func cutLogHead(path string, n int64) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Seek(n, io.SeekStart); err != nil {
+		return err
+	}
+	tail, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err = file.WriteAt(tail, 0)
+	return err
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// archiveWriter appends a new gzip member to an archive, gzip readers treat the members as one stream.
+// Lines up to the last one already in the archive are skipped.
+type archiveWriter struct {
+	path string
+	file *os.File
+	gz   *gzip.Writer // created on the first line written so skipping everything adds nothing
+
+	last     time.Time      // timestamp of the last line already archived
+	seen     map[string]int // lines already archived at last
+	caughtUp bool           // every line from here on is new
+	skipping bool           // the last timestamped line was skipped, its continuation lines go with it
+}
+
+func openArchiveWriter(path string, loc *time.Location) (*archiveWriter, error) {
+	w := &archiveWriter{path: path, seen: make(map[string]int)}
+	if err := w.readArchived(loc); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w.file = file
+	return w, nil
+}
+
+// readArchived finds the last timestamp already in the archive and the lines written at it
+func (w *archiveWriter) readArchived(loc *time.Location) error {
+	file, err := os.Open(w.path)
+	if os.IsNotExist(err) {
+		w.caughtUp = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err == io.EOF { // empty archive
+		w.caughtUp = true
+		return nil
+	}
+	if err != nil {
+		return errors.New(w.path + ": " + err.Error())
+	}
+	defer gz.Close()
+	reader := bufio.NewReader(gz)
+	parser := NewLogLineParser(loc)
+	for {
+		line, err := reader.ReadString('\n')
+		if log, perr := parser.Parse(strings.TrimRight(line, "\r\n")); perr == nil {
+			if !log.T.Equal(w.last) {
+				w.last = log.T
+				w.seen = make(map[string]int)
+			}
+			w.seen[strings.TrimRight(line, "\r\n")]++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.New(w.path + ": " + err.Error())
+		}
+	}
+	w.caughtUp = w.last.IsZero()
+	return nil
+}
+
+// WriteLine writes a line unless the archive already has it, log is nil for lines without a timestamp.
+// It returns whether the line was written.
+func (w *archiveWriter) WriteLine(line string, log *EqLog) (bool, error) {
+	if !w.caughtUp {
+		if log != nil {
+			w.skipping = w.archived(strings.TrimRight(line, "\r\n"), log.T)
+		}
+		if w.skipping {
+			return false, nil
+		}
+	}
+	if w.gz == nil {
+		w.gz = gzip.NewWriter(w.file)
+	}
+	_, err := w.gz.Write([]byte(line))
+	return err == nil, err
+}
+
+// archived returns true for lines at or before the last one already archived
+func (w *archiveWriter) archived(line string, t time.Time) bool {
+	switch {
+	case t.Before(w.last):
+		return true
+	case t.Equal(w.last) && w.seen[line] > 0:
+		w.seen[line]--
+		return true
+	}
+	w.caughtUp = true
+	return false
+}
+
+func (w *archiveWriter) Close() error {
+	if w.gz != nil {
+		if err := w.gz.Close(); err != nil {
+			w.file.Close()
+			return err
+		}
+	}
+	return w.file.Close()
+}
+
+// ArchiveReader reads a directory of eqlog .txt and .txt.gz files as a single time ordered stream.
+// Each character's archives are read one after another, only one file per character is open at a time.
+type ArchiveReader struct {
+	Location *time.Location // Zone the logs were written in, nil for local time, set before the first Next
+
+	sources archiveHeap
+	all     []*archiveSource // every source, including those finished and dropped from the heap
+	primed  bool             // every source has read its first line
+}
+
+// OpenArchiveDir opens every eqlog_*.txt and eqlog_*.txt.gz in dir
+func OpenArchiveDir(dir string) (*ArchiveReader, error) {
+	plain, err := filepath.Glob(filepath.Join(dir, "eqlog_*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	zipped, err := filepath.Glob(filepath.Join(dir, "eqlog_*.txt.gz"))
+	if err != nil {
+		return nil, err
+	}
+	paths := append(plain, zipped...)
+	sort.Strings(paths)
+	return OpenArchiveFiles(paths...)
+}
+
+// archiveDateRegex matches the date ArchiveLog adds to an archive name ex: _20210102 or _20210102-204408
+var archiveDateRegex = regexp.MustCompile(`_(\d{8}(?:-\d{6})?)$`)
+
+// OpenArchiveFiles opens specific log files, files ending in .gz are decompressed.
+// Files are grouped by character using the names ArchiveLog gives them, each group is read oldest archive first and the live log last.
+func OpenArchiveFiles(paths ...string) (*ArchiveReader, error) {
+	r := &ArchiveReader{}
+	groups := make(map[string]*archiveSource)
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".gz"), ".txt")
+		date := "~" // sorts the live log after every dated archive
+		if m := archiveDateRegex.FindStringSubmatch(name); m != nil {
+			date = m[1]
+			name = name[:len(name)-len(m[0])]
+		}
+		key := filepath.Join(filepath.Dir(path), name)
+		source, ok := groups[key]
+		if !ok {
+			source = &archiveSource{order: len(r.all)}
+			groups[key] = source
+			r.all = append(r.all, source)
+		}
+		source.paths = append(source.paths, path)
+		source.dates = append(source.dates, date)
+	}
+	for _, source := range r.all {
+		sort.Stable(source)
+		r.sources = append(r.sources, source)
+	}
+	return r, nil
+}
+
+// prime reads the first line of every character so the heap can order them
+func (r *ArchiveReader) prime() error {
+	r.primed = true
+	var sources archiveHeap
+	for _, source := range r.sources {
+		source.parser.Location = r.Location
+		if err := source.advance(); err != nil {
+			return err
+		}
+		if source.ok {
+			sources = append(sources, source)
+		}
+	}
+	r.sources = sources
+	heap.Init(&r.sources)
+	return nil
+}
+
+// Next returns the earliest unread line across all files, io.EOF once every file is finished
+func (r *ArchiveReader) Next() (EqLog, error) {
+	if !r.primed {
+		if err := r.prime(); err != nil {
+			return EqLog{}, err
+		}
+	}
+	if len(r.sources) == 0 {
+		return EqLog{}, io.EOF
+	}
+	source := r.sources[0]
+	log := source.next
+	if err := source.advance(); err != nil {
+		return EqLog{}, err
+	}
+	if source.ok {
+		heap.Fix(&r.sources, 0)
+	} else {
+		heap.Pop(&r.sources)
+	}
+	return log, nil
+}
+
+// Close closes whichever files are open
+func (r *ArchiveReader) Close() error {
+	var first error
+	for _, source := range r.all {
+		if err := source.close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// ReadArchiveDir sends every line in a directory of archives to out in time order, stopping early if ctx is done.
+// Timestamps are read in loc, nil for local time.
+func ReadArchiveDir(ctx context.Context, dir string, loc *time.Location, out chan<- EqLog) error {
+	r, err := OpenArchiveDir(dir)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	r.Location = loc
+	for {
+		log, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		select {
+		case out <- log:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// archiveSource reads one character's files in order, opening each only once the one before it is finished
+type archiveSource struct {
+	paths []string
+	dates []string // date from each archive name, used to sort paths
+	order int      // ties are broken by the order characters were first seen so equal timestamps stay stable
+
+	file   *os.File
+	gz     *gzip.Reader
+	reader *bufio.Reader
+	parser LogLineParser // shared across the character's files so DST changes read in order
+	next   EqLog
+	ok     bool
+}
+
+func (s *archiveSource) Len() int           { return len(s.paths) }
+func (s *archiveSource) Less(i, j int) bool { return s.dates[i] < s.dates[j] }
+func (s *archiveSource) Swap(i, j int) {
+	s.paths[i], s.paths[j] = s.paths[j], s.paths[i]
+	s.dates[i], s.dates[j] = s.dates[j], s.dates[i]
+}
+
+// advance reads the next parseable line into next, moving on to the next file at the end of each one, ok is false once every file is finished
+func (s *archiveSource) advance() error {
+	for {
+		if s.reader == nil {
+			if len(s.paths) == 0 {
+				s.ok = false
+				return nil
+			}
+			if err := s.open(s.paths[0]); err != nil {
+				return err
+			}
+			s.paths, s.dates = s.paths[1:], s.dates[1:]
+		}
+		line, err := s.reader.ReadString('\n')
+		if line != "" {
+			if log, perr := s.parser.Parse(strings.TrimRight(line, "\r\n")); perr == nil {
+				s.next = *log
+				s.ok = true
+				return nil
+			}
+		}
+		if err == io.EOF {
+			if err := s.close(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *archiveSource) open(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	var in io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			s.close()
+			return errors.New(path + ": " + err.Error())
+		}
+		s.gz = gz
+		in = gz
+	}
+	s.reader = bufio.NewReader(in)
+	return nil
+}
+
+// close closes the file being read, if any
+func (s *archiveSource) close() error {
+	var err error
+	if s.gz != nil {
+		err = s.gz.Close()
+	}
+	if s.file != nil {
+		if cerr := s.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	s.file, s.gz, s.reader = nil, nil, nil
+	return err
+}
+
+type archiveHeap []*archiveSource
+
+func (h archiveHeap) Len() int { return len(h) }
+func (h archiveHeap) Less(i, j int) bool {
+	if h[i].next.T.Equal(h[j].next.T) {
+		return h[i].order < h[j].order
+	}
+	return h[i].next.T.Before(h[j].next.T)
+}
+func (h archiveHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *archiveHeap) Push(x interface{}) { *h = append(*h, x.(*archiveSource)) }
+func (h *archiveHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
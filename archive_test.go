@@ -0,0 +1,160 @@
+package everquest
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchiveLogTwice(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "eqlog_Mortimus_P1999Green.txt")
+	lines := []string{
+		"[Sat Jan 02 20:44:08 2021] Destrod tells the guild, 'takings bids on Shawl of Perception pst'",
+		"[Sat Jan 02 20:45:00 2021] Kaijin tells the guild, 'Shawl of Perception 50'",
+		"[Sat Jan 02 20:45:00 2021] Kaijin tells the guild, 'Shawl of Perception 50'",
+		"[Sun Jan 03 19:00:00 2021] You have entered Veeshan's Peak.",
+	}
+	os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	archives := filepath.Join(dir, "archive")
+	opts := ArchiveOptions{Location: time.UTC}
+	written, err := ArchiveLog(path, archives, opts)
+	if err != nil || len(written) != 2 {
+		t.Fatalf("Error archiving log: %v %v", written, err)
+	}
+	written, err = ArchiveLog(path, archives, opts)
+	if err != nil || len(written) != 0 {
+		t.Fatalf("Error archiving the same log again wrote %v: %v", written, err)
+	}
+
+	more := []string{
+		"[Sun Jan 03 19:00:00 2021] You have entered Veeshan's Peak.",
+		"[Sun Jan 03 19:05:00 2021] Kaijin tells the raid, 'inc'",
+	}
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(strings.Join(more, "\n") + "\n")
+	f.Close()
+	written, err = ArchiveLog(path, archives, opts)
+	if err != nil || len(written) != 1 || filepath.Base(written[0]) != "eqlog_Mortimus_P1999Green_20210103.txt.gz" {
+		t.Fatalf("Error archiving a grown log: %v %v", written, err)
+	}
+
+	if got := readArchive(t, filepath.Join(archives, "eqlog_Mortimus_P1999Green_20210102.txt.gz")); strings.Join(got, "\n") != strings.Join(lines[:3], "\n") {
+		t.Fatalf("Error archiving first day, got %v", got)
+	}
+	if got := readArchive(t, written[0]); strings.Join(got, "\n") != strings.Join(append(lines[3:], more...), "\n") {
+		t.Fatalf("Error appending to second day, got %v", got)
+	}
+}
+
+func TestArchiveLogTruncate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "eqlog_Mortimus_P1999Green.txt")
+	lines := []string{
+		"[Sat Jan 02 20:44:08 2021] Destrod tells the guild, 'takings bids on Shawl of Perception pst'",
+		"[Sat Jan 02 20:45:00 2021] Kaijin tells the guild, 'Shawl of Perception 50'",
+	}
+	partial := "[Sun Jan 03 19:00:00 2021] You have ent"
+	os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"+partial), 0644)
+	archives := filepath.Join(dir, "archive")
+	opts := ArchiveOptions{Location: time.UTC, Truncate: true}
+	written, err := ArchiveLog(path, archives, opts)
+	if err != nil || len(written) != 1 {
+		t.Fatalf("Error archiving log: %v %v", written, err)
+	}
+	if got := readArchive(t, written[0]); strings.Join(got, "\n") != strings.Join(lines, "\n") {
+		t.Fatalf("Error archiving complete lines, got %v", got)
+	}
+	if left, _ := os.ReadFile(path); string(left) != partial {
+		t.Fatalf("Error keeping the line still being written, log holds %q", left)
+	}
+
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("ered Veeshan's Peak.\n")
+	f.Close()
+	written, err = ArchiveLog(path, archives, opts)
+	if err != nil || len(written) != 1 {
+		t.Fatalf("Error archiving the rest of the log: %v %v", written, err)
+	}
+	if got := readArchive(t, written[0]); len(got) != 1 || got[0] != partial+"ered Veeshan's Peak." {
+		t.Fatalf("Error archiving the finished line, got %v", got)
+	}
+	if left, _ := os.ReadFile(path); len(left) != 0 {
+		t.Fatalf("Error truncating archived log, log holds %q", left)
+	}
+}
+
+func readArchive(t *testing.T, path string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Error opening archive: %v", err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Error reading archive: %v", err)
+	}
+	var lines []string
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+func TestArchiveReader(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, lines ...string) {
+		path := filepath.Join(dir, name)
+		if !strings.HasSuffix(name, ".gz") {
+			os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+			return
+		}
+		file, _ := os.Create(path)
+		gz := gzip.NewWriter(file)
+		gz.Write([]byte(strings.Join(lines, "\n") + "\n"))
+		gz.Close()
+		file.Close()
+	}
+	write("eqlog_Mortimus_P1999Green_20210102.txt.gz", "[Sat Jan 02 20:00:00 2021] Mortimus 1")
+	write("eqlog_Mortimus_P1999Green_20210103.txt.gz", "[Sun Jan 03 20:00:00 2021] Mortimus 2")
+	write("eqlog_Mortimus_P1999Green.txt", "[Mon Jan 04 20:00:00 2021] Mortimus 3")
+	write("eqlog_Kaijin_P1999Green_20210102-203000.txt.gz", "[Sat Jan 02 20:30:00 2021] Kaijin 1", "[Sun Jan 03 21:00:00 2021] Kaijin 2")
+
+	r, err := OpenArchiveDir(dir)
+	if err != nil {
+		t.Fatalf("Error opening archives: %v", err)
+	}
+	defer r.Close()
+	r.Location = time.UTC
+	if len(r.all) != 2 {
+		t.Fatalf("Error grouping archives by character, got %d groups", len(r.all))
+	}
+	var got []string
+	for {
+		log, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Error reading archives: %v", err)
+		}
+		got = append(got, log.Msg)
+		if len(got) == 1 && len(r.all[1].paths) != 1 { // Mortimus, having moved on to their second archive
+			t.Fatalf("Error opened later archives early, %d left unopened", len(r.all[1].paths))
+		}
+	}
+	want := "Mortimus 1,Kaijin 1,Mortimus 2,Kaijin 2,Mortimus 3"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("Error merging archives, got %v", got)
+	}
+
+	if _, err := OpenArchiveFiles(filepath.Join(dir, "eqlog_Ryze_P1999Green.txt")); err == nil {
+		t.Fatalf("Error missing file was not reported")
+	}
+}
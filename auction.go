@@ -0,0 +1,349 @@
+package everquest
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuctionBid is a single bid sent to the auctioneer
+type AuctionBid struct {
+	T         time.Time
+	Bidder    string
+	Amount    int
+	Retracted bool // The bidder withdrew this bid
+}
+
+// Auction is one item auctioned in chat and every bid it received
+type Auction struct {
+	Item       string    // Item name as announced, or the item database name if it was resolved
+	ItemID     int       // -1 if the item could not be found
+	Auctioneer string    // Who opened the auction
+	Channel    string    // Channel the auction was announced in
+	Opened     time.Time // When the auction was announced
+	Deadline   time.Time // When bids close if a time was announced, zero otherwise
+	Closed     time.Time // When bidding closed, zero while still open
+	Bids       []AuctionBid
+	Winner     string   // Highest bidder, empty if there were no bids or the top bid was tied
+	WinningBid int      // Highest bid amount
+	Tied       []string // Every bidder sharing the highest bid when there is a tie
+}
+
+// Open returns true until bidding has closed
+func (a *Auction) Open() bool {
+	return a.Closed.IsZero()
+}
+
+// Standing returns each bidder's current bid, a later bid replaces an earlier one and retracted bids are dropped
+func (a *Auction) Standing() []AuctionBid {
+	latest := make(map[string]AuctionBid)
+	for _, bid := range a.Bids {
+		if bid.Retracted {
+			delete(latest, bid.Bidder)
+			continue
+		}
+		latest[bid.Bidder] = bid
+	}
+	var standing []AuctionBid
+	for _, bid := range latest {
+		standing = append(standing, bid)
+	}
+	sort.Slice(standing, func(i, j int) bool {
+		if standing[i].Amount == standing[j].Amount {
+			return standing[i].T.Before(standing[j].T)
+		}
+		return standing[i].Amount > standing[j].Amount
+	})
+	return standing
+}
+
+// resolve works out the winner from the standing bids
+func (a *Auction) resolve() {
+	a.Winner, a.WinningBid, a.Tied = "", 0, nil
+	standing := a.Standing()
+	if len(standing) == 0 {
+		return
+	}
+	a.WinningBid = standing[0].Amount
+	for _, bid := range standing {
+		if bid.Amount == a.WinningBid {
+			a.Tied = append(a.Tied, bid.Bidder)
+		}
+	}
+	if len(a.Tied) == 1 {
+		a.Winner = a.Tied[0]
+		a.Tied = nil
+		return
+	}
+	sort.Strings(a.Tied)
+}
+
+var (
+	auctionOpenRegex     = regexp.MustCompile(`(?i)\b(?:taking|takings|accepting|open(?:ing)?) bids (?:on|for) (.+)$|^(?:now )?(?:bidding|auctioning) (?:on |for )?(.+)$`)
+	auctionEndItemRegex  = regexp.MustCompile(`(?i)\s*(?:[,!]|\.(?:\s|$)|\bpst\b|\b/t\b|\btell\b|\bbids?\b|\bclos(?:e|es|ing)\b|\bends?\b|\bmin\b|\bx\d+\b).*$`)
+	auctionDeadlineRegex = regexp.MustCompile(`(?i)\b(\d+)\s*(m|mins?|minutes?|s|secs?|seconds?)\b`)
+	auctionCloseRegex    = regexp.MustCompile(`(?i)\b(?:bids? (?:are |is )?closed|closed|grats|gratz|congrats|sold)\b`)
+	auctionRetractRegex  = regexp.MustCompile(`(?i)\b(?:retract|cancel|withdraw|nvm|nevermind)\b`)
+	auctionAmountRegex   = regexp.MustCompile(`(?i)\b(\d+)\s*(?:dkp)?\b`)
+	auctionBidRegex      = regexp.MustCompile(`(?i)^\s*(\d+)\s*(?:dkp)?\s*[.!]*\s*$|\bbid\s+(\d+)\b|\b(\d+)\s*dkp\b`) // a bid that doesn't name the item ex: 50, bid 50, 50 dkp
+	auctionBidWordRegex  = regexp.MustCompile(`(?i)\bbids?\b`)
+)
+
+// AuctionTracker follows loot auctions run in chat, collecting the bids told to the log owner.
+// Bids only count towards auctions the log owner is running, and a tell only counts as a bid if it names the item or is plainly a bid.
+type AuctionTracker struct {
+	LogOwner                    // Character is the auctioneer receiving bid tells, auctions are read from chat so Parser is unused
+	Channels      []string      // Channels auctions are announced in, defaults to guild
+	Auctioneers   []string      // Only auctions opened by these players are tracked, empty allows anyone
+	Items         *ItemDB       // Used to resolve item names and ids, may be nil
+	MaxFuzzyEdits int           // Edits allowed when an announced item doesn't match exactly, 0 disables fuzzy matching
+	OnClose       func(Auction) // Called with every auction as it closes, may be nil
+
+	open   []*Auction
+	closed []Auction
+	last   time.Time // time of the last log added
+}
+
+// NewAuctionTracker creates a tracker for the log of character, resolving items against items
+func NewAuctionTracker(character string, items *ItemDB) *AuctionTracker {
+	return &AuctionTracker{
+		LogOwner:      LogOwner{Character: character},
+		Channels:      []string{"guild"},
+		Items:         items,
+		MaxFuzzyEdits: 2,
+	}
+}
+
+// Add reads a log line, closing any auctions whose deadline has passed first
+func (t *AuctionTracker) Add(log EqLog) {
+	if log.T.After(t.last) {
+		t.last = log.T
+	}
+	t.CheckDeadlines(log.T)
+	chat := ClassifyMessage(log.Msg)
+	switch {
+	case chat.Channel == ChannelTell && chat.Direction == ChatIncoming:
+		t.addTell(log, chat)
+	case t.auctionChannel(log.Channel) && chat.Direction != "":
+		t.addAnnouncement(log, chat)
+	}
+}
+
+// Run adds every log from in, as sent by BufferedLogRead, closing whatever is still open at the time of the last log once in is closed
+func (t *AuctionTracker) Run(in <-chan EqLog) {
+	for log := range in {
+		t.Add(log)
+	}
+	t.CloseAll(t.last)
+}
+
+// CheckDeadlines closes every auction whose announced deadline is before now
+func (t *AuctionTracker) CheckDeadlines(now time.Time) {
+	for _, a := range t.Open() {
+		if !a.Deadline.IsZero() && now.After(a.Deadline) {
+			t.close(a, a.Deadline)
+		}
+	}
+}
+
+// CloseAll closes every open auction at now
+func (t *AuctionTracker) CloseAll(now time.Time) {
+	for _, a := range t.Open() {
+		t.close(a, now)
+	}
+}
+
+// Open returns the auctions still taking bids, oldest first
+func (t *AuctionTracker) Open() []*Auction {
+	open := make([]*Auction, len(t.open))
+	copy(open, t.open)
+	return open
+}
+
+// Closed returns every finished auction in the order they closed
+func (t *AuctionTracker) Closed() []Auction {
+	return t.closed
+}
+
+func (t *AuctionTracker) addAnnouncement(log EqLog, chat ChatMessage) {
+	auctioneer := t.resolveName(chat.Speaker)
+	if !t.isAuctioneer(auctioneer) {
+		return
+	}
+	if m := auctionOpenRegex.FindStringSubmatch(chat.Body); m != nil {
+		text := m[1]
+		if text == "" {
+			text = m[2]
+		}
+		name, id := t.resolveItem(text)
+		if name == "" {
+			return
+		}
+		if existing := t.find(name); existing != nil { // a repeated announcement keeps the bids already placed
+			existing.Deadline = auctionDeadline(log.T, chat.Body)
+			return
+		}
+		t.open = append(t.open, &Auction{
+			Item:       name,
+			ItemID:     id,
+			Auctioneer: auctioneer,
+			Channel:    log.Channel,
+			Opened:     log.T,
+			Deadline:   auctionDeadline(log.T, chat.Body),
+		})
+		return
+	}
+	if auctionCloseRegex.MatchString(chat.Body) {
+		if a, _ := t.match(chat.Body, auctioneer); a != nil {
+			t.close(a, log.T)
+		}
+	}
+}
+
+func (t *AuctionTracker) addTell(log EqLog, chat ChatMessage) {
+	a, named := t.match(chat.Body, t.resolveName("You"))
+	if a == nil {
+		return
+	}
+	body := strings.ToLower(chat.Body)
+	if named {
+		body = strings.Replace(body, strings.ToLower(a.Item), "", 1) // item names can contain numbers
+	}
+	bid := AuctionBid{T: log.T, Bidder: chat.Speaker}
+	if auctionRetractRegex.MatchString(body) {
+		if named || auctionBidWordRegex.MatchString(body) {
+			bid.Retracted = true
+			a.Bids = append(a.Bids, bid)
+		}
+		return
+	}
+	amount, ok := bidAmount(body, named)
+	if !ok {
+		return
+	}
+	bid.Amount = amount
+	a.Bids = append(a.Bids, bid)
+}
+
+// bidAmount reads the amount from a bid tell, one that doesn't name the item has to be nothing but a bid
+func bidAmount(body string, named bool) (int, bool) {
+	if named {
+		m := auctionAmountRegex.FindStringSubmatch(body)
+		if m == nil {
+			return 0, false
+		}
+		amount, _ := strconv.Atoi(m[1])
+		return amount, true
+	}
+	m := auctionBidRegex.FindStringSubmatch(body)
+	if m == nil {
+		return 0, false
+	}
+	for _, group := range m[1:] {
+		if group != "" {
+			amount, _ := strconv.Atoi(group)
+			return amount, true
+		}
+	}
+	return 0, false
+}
+
+// match finds the open auction a message refers to, by item name or by being the only one open, named is true if the item was named
+func (t *AuctionTracker) match(msg, auctioneer string) (a *Auction, named bool) {
+	lower := strings.ToLower(msg)
+	var candidates []*Auction
+	for _, a := range t.open {
+		if auctioneer != "" && a.Auctioneer != auctioneer {
+			continue
+		}
+		if strings.Contains(lower, strings.ToLower(a.Item)) {
+			return a, true
+		}
+		candidates = append(candidates, a)
+	}
+	if len(candidates) == 1 {
+		return candidates[0], false
+	}
+	return nil, false
+}
+
+func (t *AuctionTracker) find(item string) *Auction {
+	for _, a := range t.open {
+		if strings.EqualFold(a.Item, item) {
+			return a
+		}
+	}
+	return nil
+}
+
+func (t *AuctionTracker) close(a *Auction, at time.Time) {
+	for i, open := range t.open {
+		if open == a {
+			t.open = append(t.open[:i], t.open[i+1:]...)
+			break
+		}
+	}
+	a.Closed = at
+	a.resolve()
+	t.closed = append(t.closed, *a)
+	if t.OnClose != nil {
+		t.OnClose(*a)
+	}
+}
+
+// resolveItem finds the item in an announcement, trying the longest run of words that is a known item before falling back to trimming common chatter
+func (t *AuctionTracker) resolveItem(text string) (string, int) {
+	text = strings.TrimSpace(text)
+	if t.Items != nil {
+		words := strings.Fields(text)
+		for n := len(words); n > 0; n-- {
+			candidate := strings.Trim(strings.Join(words[:n], " "), ",.!-")
+			if id, err := t.Items.FindIDByName(candidate); err == nil {
+				return t.itemName(id, candidate), id
+			}
+		}
+	}
+	name := strings.TrimSpace(auctionEndItemRegex.ReplaceAllString(text, ""))
+	if name == "" {
+		return "", -1
+	}
+	if t.Items != nil && t.MaxFuzzyEdits > 0 {
+		if id, err := t.Items.FindClosestIDByName(name, t.MaxFuzzyEdits); err == nil {
+			return t.itemName(id, name), id
+		}
+	}
+	return name, -1
+}
+
+func (t *AuctionTracker) itemName(id int, fallback string) string {
+	if item, err := t.Items.GetItemByID(id); err == nil && item.Name != "" {
+		return item.Name
+	}
+	return fallback
+}
+
+// auctionDeadline reads an announced closing time ex: bids close in 2mins
+func auctionDeadline(opened time.Time, msg string) time.Time {
+	m := auctionDeadlineRegex.FindStringSubmatch(msg)
+	if m == nil {
+		return time.Time{}
+	}
+	n, _ := strconv.Atoi(m[1])
+	if strings.HasPrefix(strings.ToLower(m[2]), "s") {
+		return opened.Add(time.Duration(n) * time.Second)
+	}
+	return opened.Add(time.Duration(n) * time.Minute)
+}
+
+func (t *AuctionTracker) auctionChannel(channel string) bool {
+	if len(t.Channels) == 0 {
+		return channel == "guild"
+	}
+	return containsFold(t.Channels, channel)
+}
+
+func (t *AuctionTracker) isAuctioneer(name string) bool {
+	return len(t.Auctioneers) == 0 || containsFold(t.Auctioneers, name)
+}
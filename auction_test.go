@@ -0,0 +1,84 @@
+package everquest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuctionTracker(t *testing.T) {
+	lines := []string{
+		"[Sat Jan 02 20:44:08 2021] Destrod tells the guild, 'takings bids on Shawl of Perception pst bids close in 2mins'",
+		"[Sat Jan 02 20:44:10 2021] Kaijin tells the guild, 'taking bids on Cloak of Flames'",
+		"[Sat Jan 02 20:44:20 2021] Ryze tells you, 'brb 5 min need to afk'",
+		"[Sat Jan 02 20:44:25 2021] Voltha tells you, 'want to group at 9?'",
+		"[Sat Jan 02 20:44:30 2021] Ryze tells you, '50'",
+		"[Sat Jan 02 20:44:35 2021] Voltha tells you, 'bid 55'",
+		"[Sat Jan 02 20:44:40 2021] Scylla tells you, '60 dkp'",
+		"[Sat Jan 02 20:44:45 2021] Patchouli tells you, 'Shawl of Perception 70'",
+		"[Sat Jan 02 20:44:50 2021] Banis tells you, 'Cloak of Flames 500'", // not Destrod's auction
+		"[Sat Jan 02 20:45:00 2021] Patchouli tells you, 'cancel my bid'",
+		"[Sat Jan 02 20:47:00 2021] Destrod tells the guild, 'next up'",
+	}
+	tracker := NewAuctionTracker("Destrod", nil)
+	for _, line := range lines {
+		log, err := ParseLogLine(line)
+		if err != nil {
+			t.Fatalf("Error parsing %s: %v", line, err)
+		}
+		tracker.Add(*log)
+	}
+
+	closed := tracker.Closed()
+	if len(closed) != 1 || closed[0].Item != "Shawl of Perception" {
+		t.Fatalf("Error closing auction at its deadline: %+v", closed)
+	}
+	shawl := closed[0]
+	if len(shawl.Bids) != 5 {
+		t.Fatalf("Error counting bids, got %+v", shawl.Bids)
+	}
+	for _, bid := range shawl.Bids {
+		if bid.Bidder == "Banis" || (bid.Bidder == "Ryze" && bid.Amount != 50) || (bid.Bidder == "Voltha" && bid.Amount != 55) {
+			t.Fatalf("Error counted chatter as a bid: %+v", bid)
+		}
+	}
+	if shawl.Winner != "Scylla" || shawl.WinningBid != 60 {
+		t.Fatalf("Error picking winner after a retraction: %s %d", shawl.Winner, shawl.WinningBid)
+	}
+	if open := tracker.Open(); len(open) != 1 || open[0].Auctioneer != "Kaijin" || len(open[0].Bids) != 0 {
+		t.Fatalf("Error bids counted for another player's auction: %+v", open)
+	}
+}
+
+func TestAuctionTrackerTie(t *testing.T) {
+	lines := []string{
+		"[Sat Jan 02 20:44:08 2021] You say to your guild, 'taking bids on Shawl of Perception'",
+		"[Sat Jan 02 20:44:30 2021] Ryze tells you, '60'",
+		"[Sat Jan 02 20:44:35 2021] Voltha tells you, 'bid 40'",
+		"[Sat Jan 02 20:44:40 2021] Scylla tells you, '60 dkp'",
+		"[Sat Jan 02 20:45:00 2021] Voltha tells you, 'Shawl of Perception 60'",
+		"[Sat Jan 02 20:45:10 2021] Voltha tells you, 'cancel my bid'",
+	}
+	in := make(chan EqLog, len(lines))
+	for _, line := range lines {
+		log, err := ParseLogLine(line)
+		if err != nil {
+			t.Fatalf("Error parsing %s: %v", line, err)
+		}
+		in <- *log
+	}
+	close(in)
+	tracker := NewAuctionTracker("Destrod", nil)
+	tracker.Run(in)
+
+	closed := tracker.Closed()
+	if len(closed) != 1 {
+		t.Fatalf("Error closing open auctions when the logs end: %+v", closed)
+	}
+	shawl := closed[0]
+	if shawl.Auctioneer != "Destrod" || !shawl.Closed.Equal(time.Date(2021, time.January, 2, 20, 45, 10, 0, time.Local)) {
+		t.Fatalf("Error closing at the time of the last log: %s %s", shawl.Auctioneer, shawl.Closed)
+	}
+	if shawl.Winner != "" || shawl.WinningBid != 60 || len(shawl.Tied) != 2 || shawl.Tied[0] != "Ryze" || shawl.Tied[1] != "Scylla" {
+		t.Fatalf("Error resolving a tie: winner %s bid %d tied %v", shawl.Winner, shawl.WinningBid, shawl.Tied)
+	}
+}
@@ -0,0 +1,237 @@
+package everquest
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy decides what happens to a log when a subscriber's buffer is full
+type OverflowPolicy int
+
+const (
+	OverflowBlock      OverflowPolicy = iota // Wait for the subscriber, holding up every subscriber after it
+	OverflowDropOldest                       // Throw away the oldest buffered log to make room
+	OverflowDropNewest                       // Throw away the new log
+)
+
+// LogFilter selects which logs a subscriber receives, empty fields match everything
+type LogFilter struct {
+	Channels []string       // Only logs in any of these channels
+	Sources  []string       // Only logs from any of these sources
+	Pattern  *regexp.Regexp // Only logs whose message matches
+}
+
+// Match returns true if the log passes every part of the filter
+func (f LogFilter) Match(log EqLog) bool {
+	if len(f.Channels) > 0 && !containsFold(f.Channels, log.Channel) {
+		return false
+	}
+	if len(f.Sources) > 0 && !containsFold(f.Sources, log.Source) {
+		return false
+	}
+	if f.Pattern != nil && !f.Pattern.MatchString(log.Msg) {
+		return false
+	}
+	return true
+}
+
+// Subscription is one consumer of a Broker
+type Subscription struct {
+	C      <-chan EqLog // Receives every matching log, closed once unsubscribed or the broker closes
+	Filter LogFilter
+	Policy OverflowPolicy
+
+	c         chan EqLog
+	broker    *Broker
+	done      chan struct{}
+	once      sync.Once
+	mu        sync.Mutex // held while sending so the channel isn't closed mid send
+	closed    bool
+	delivered uint64
+	dropped   uint64
+}
+
+// Delivered returns how many logs have been handed to the subscriber
+func (s *Subscription) Delivered() uint64 {
+	return atomic.LoadUint64(&s.delivered)
+}
+
+// Dropped returns how many matching logs were thrown away because the subscriber fell behind
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Unsubscribe stops delivery and closes C, it is safe to call more than once
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		close(s.done) // releases a blocked send before taking the lock
+		s.broker.remove(s)
+		s.mu.Lock()
+		s.closed = true
+		close(s.c)
+		s.mu.Unlock()
+	})
+}
+
+// send hands the log to the subscriber, an OverflowBlock subscriber is waited on until ctx is done
+func (s *Subscription) send(ctx context.Context, log EqLog) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	switch s.Policy {
+	case OverflowDropNewest:
+		select {
+		case s.c <- log:
+			atomic.AddUint64(&s.delivered, 1)
+		default:
+			s.drop()
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.c <- log:
+				atomic.AddUint64(&s.delivered, 1)
+				return
+			default:
+			}
+			select {
+			case <-s.c:
+				s.drop()
+				atomic.AddUint64(&s.delivered, ^uint64(0)) // the dropped log was counted when it was buffered
+			default:
+			}
+		}
+	default:
+		select {
+		case s.c <- log:
+			atomic.AddUint64(&s.delivered, 1)
+		case <-s.done:
+		case <-ctx.Done():
+		}
+	}
+}
+
+func (s *Subscription) drop() {
+	atomic.AddUint64(&s.dropped, 1)
+	atomic.AddUint64(&s.broker.dropped, 1)
+}
+
+// Broker fans a single log stream out to many subscribers, each with its own filter and buffer
+type Broker struct {
+	dropped uint64 // every drop since the broker was created, first in the struct to keep it 64 bit aligned for atomic use
+
+	mu     sync.Mutex
+	subs   []*Subscription
+	closed bool
+}
+
+// NewBroker creates a broker with no subscribers
+func NewBroker() *Broker {
+	return &Broker{}
+}
+
+// Subscribe adds a subscriber receiving the logs matching filter through a buffer of size buffer.
+// Subscribing to a closed broker returns a subscription whose channel is already closed.
+func (b *Broker) Subscribe(filter LogFilter, buffer int, policy OverflowPolicy) *Subscription {
+	if buffer < 0 {
+		buffer = 0
+	}
+	if policy == OverflowDropOldest && buffer == 0 { // there is nothing to drop from an unbuffered channel
+		buffer = 1
+	}
+	c := make(chan EqLog, buffer)
+	s := &Subscription{C: c, Filter: filter, Policy: policy, c: c, broker: b, done: make(chan struct{})}
+	b.mu.Lock()
+	closed := b.closed
+	if !closed {
+		b.subs = append(b.subs, s)
+	}
+	b.mu.Unlock()
+	if closed {
+		s.Unsubscribe()
+	}
+	return s
+}
+
+// Publish sends a log to every subscriber whose filter matches
+func (b *Broker) Publish(log EqLog) {
+	b.PublishContext(context.Background(), log)
+}
+
+// PublishContext sends a log to every subscriber whose filter matches, giving up on blocked subscribers once ctx is done.
+// It returns ctx.Err() if the log may not have reached every subscriber.
+func (b *Broker) PublishContext(ctx context.Context, log EqLog) error {
+	b.mu.Lock()
+	subs := make([]*Subscription, len(b.subs))
+	copy(subs, b.subs)
+	b.mu.Unlock()
+	for _, s := range subs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if s.Filter.Match(log) {
+			s.send(ctx, log)
+		}
+	}
+	return ctx.Err()
+}
+
+// Run publishes every log from in until it is closed or ctx is done, then closes the broker.
+// A full OverflowBlock subscriber holds up Run only until ctx is done.
+func (b *Broker) Run(ctx context.Context, in <-chan EqLog) {
+	defer b.Close()
+	for {
+		select {
+		case log, ok := <-in:
+			if !ok {
+				return
+			}
+			if b.PublishContext(ctx, log) != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close unsubscribes everyone, closing their channels
+func (b *Broker) Close() {
+	b.mu.Lock()
+	b.closed = true
+	subs := b.subs
+	b.subs = nil
+	b.mu.Unlock()
+	for _, s := range subs {
+		s.Unsubscribe()
+	}
+}
+
+// Subscriptions returns every current subscriber, for reporting their metrics
+func (b *Broker) Subscriptions() []*Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subs := make([]*Subscription, len(b.subs))
+	copy(subs, b.subs)
+	return subs
+}
+
+// Dropped returns the logs dropped across every subscriber, including those that have since unsubscribed
+func (b *Broker) Dropped() uint64 {
+	return atomic.LoadUint64(&b.dropped)
+}
+
+func (b *Broker) remove(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, sub := range b.subs {
+		if sub == s {
+			b.subs = append(b.subs[:i], b.subs[i+1:]...)
+			return
+		}
+	}
+}
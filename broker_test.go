@@ -0,0 +1,143 @@
+package everquest
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func brokerLog(i int) EqLog {
+	return EqLog{T: time.Date(2021, time.January, 2, 20, 0, i, 0, time.Local), Msg: "line " + strconv.Itoa(i), Channel: "guild", Source: "Kaijin"}
+}
+
+// received drains whatever is buffered on c without waiting
+func received(c <-chan EqLog) []string {
+	var msgs []string
+	for {
+		select {
+		case log, ok := <-c:
+			if !ok {
+				return msgs
+			}
+			msgs = append(msgs, log.Msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+func TestBrokerDropPolicies(t *testing.T) {
+	b := NewBroker()
+	newest := b.Subscribe(LogFilter{}, 2, OverflowDropNewest)
+	oldest := b.Subscribe(LogFilter{}, 2, OverflowDropOldest)
+	filtered := b.Subscribe(LogFilter{Channels: []string{"raid"}, Pattern: regexp.MustCompile(`^line`)}, 0, OverflowBlock)
+	for i := 1; i <= 5; i++ {
+		b.Publish(brokerLog(i))
+	}
+
+	if got := received(newest.C); len(got) != 2 || got[0] != "line 1" || got[1] != "line 2" || newest.Dropped() != 3 || newest.Delivered() != 2 {
+		t.Fatalf("Error dropping newest: %v dropped %d delivered %d", got, newest.Dropped(), newest.Delivered())
+	}
+	if got := received(oldest.C); len(got) != 2 || got[0] != "line 4" || got[1] != "line 5" || oldest.Dropped() != 3 || oldest.Delivered() != 2 {
+		t.Fatalf("Error dropping oldest: %v dropped %d delivered %d", got, oldest.Dropped(), oldest.Delivered())
+	}
+	if filtered.Delivered() != 0 {
+		t.Fatalf("Error filter let through %d logs", filtered.Delivered())
+	}
+	if b.Dropped() != 6 {
+		t.Fatalf("Error totalling drops, got %d", b.Dropped())
+	}
+	newest.Unsubscribe()
+	oldest.Unsubscribe()
+	if b.Dropped() != 6 || len(b.Subscriptions()) != 1 {
+		t.Fatalf("Error drops were lost on unsubscribe, got %d", b.Dropped())
+	}
+	b.Close()
+	if _, ok := <-filtered.C; ok {
+		t.Fatalf("Error closing the broker left a channel open")
+	}
+}
+
+func TestBrokerBlock(t *testing.T) {
+	b := NewBroker()
+	s := b.Subscribe(LogFilter{}, 1, OverflowBlock)
+	b.Publish(brokerLog(1))
+	published := make(chan struct{})
+	go func() {
+		b.Publish(brokerLog(2))
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatalf("Error publish did not wait for a full subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if log := <-s.C; log.Msg != "line 1" {
+		t.Fatalf("Error receiving in order, got %s", log.Msg)
+	}
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatalf("Error publish stayed blocked after the subscriber caught up")
+	}
+	if log := <-s.C; log.Msg != "line 2" || s.Delivered() != 2 || s.Dropped() != 0 {
+		t.Fatalf("Error blocking delivery, got %s delivered %d dropped %d", log.Msg, s.Delivered(), s.Dropped())
+	}
+	b.Close()
+}
+
+func TestBrokerUnsubscribeWhileBlocked(t *testing.T) {
+	b := NewBroker()
+	s := b.Subscribe(LogFilter{}, 0, OverflowBlock)
+	other := b.Subscribe(LogFilter{}, 1, OverflowDropNewest)
+	published := make(chan struct{})
+	go func() {
+		b.Publish(brokerLog(1))
+		close(published)
+	}()
+	time.Sleep(20 * time.Millisecond) // let the publish block on s
+	s.Unsubscribe()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatalf("Error unsubscribe did not release a blocked publish")
+	}
+	if _, ok := <-s.C; ok {
+		t.Fatalf("Error unsubscribed channel still open")
+	}
+	if got := received(other.C); len(got) != 1 {
+		t.Fatalf("Error later subscriber missed the log: %v", got)
+	}
+	b.Publish(brokerLog(2)) // nothing is sent to s once it is gone
+	s.Unsubscribe()
+	b.Close()
+}
+
+func TestBrokerRunCancelWhileBlocked(t *testing.T) {
+	b := NewBroker()
+	s := b.Subscribe(LogFilter{}, 1, OverflowBlock)
+	in := make(chan EqLog, 2)
+	in <- brokerLog(1)
+	in <- brokerLog(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		b.Run(ctx, in)
+		close(stopped)
+	}()
+	time.Sleep(20 * time.Millisecond) // let the second log block on the full subscriber
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("Error cancelling did not stop a run blocked on a full subscriber")
+	}
+	if got := received(s.C); len(got) != 1 || got[0] != "line 1" {
+		t.Fatalf("Error delivering before the cancel: %v", got)
+	}
+	if _, ok := <-s.C; ok {
+		t.Fatalf("Error broker not closed after run stopped")
+	}
+}
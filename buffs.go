@@ -0,0 +1,304 @@
+package everquest
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BuffTick is how long a single buff tick lasts
+const BuffTick = 6 * time.Second
+
+// BuffTicks returns how many ticks a spell lasts when cast at level, following the EQEmu duration formulas.
+// Permanent effects return -1 and spells without a duration return 0.
+func BuffTicks(spell Spell, level int) int {
+	var ticks int
+	switch spell.Durationformula {
+	case 0:
+		return 0
+	case 1:
+		ticks = 1
+		if level > 3 {
+			ticks = level / 2
+		}
+	case 2:
+		ticks = 6
+		if level > 3 {
+			ticks = level/2 + 5
+		}
+	case 3:
+		ticks = 30 * level
+	case 4:
+		ticks = 50
+	case 5:
+		ticks = 2
+	case 6:
+		ticks = level/2 + 2
+	case 7:
+		ticks = level
+	case 8:
+		ticks = level + 10
+	case 9:
+		ticks = 2*level + 10
+	case 10:
+		ticks = 3*level + 10
+	case 11:
+		ticks = 30 * (level + 3)
+	case 12:
+		ticks = 1
+		if level > 7 {
+			ticks = level / 4
+		}
+	case 13:
+		ticks = 4*level + 10
+	case 14:
+		ticks = 5 * (level + 2)
+	case 15:
+		ticks = 10 * (level + 10)
+	case 50, 51: // permanent until cancelled or out of range of an aura
+		return -1
+	default:
+		if spell.Durationformula < 200 {
+			return 0
+		}
+		ticks = spell.Durationformula
+	}
+	if spell.Duration > 0 && spell.Duration < ticks { // Duration caps the formula
+		ticks = spell.Duration
+	}
+	return ticks
+}
+
+// BuffDuration returns how long a spell lasts when cast at level, -1 if it is permanent
+func BuffDuration(spell Spell, level int) time.Duration {
+	ticks := BuffTicks(spell, level)
+	if ticks < 0 {
+		return -1
+	}
+	return time.Duration(ticks) * BuffTick
+}
+
+// ActiveEffect is a buff or debuff currently on a target
+type ActiveEffect struct {
+	Target    string
+	Spell     Spell
+	Caster    string    // Empty if the caster wasn't seen
+	Level     int       // Caster level used to work out the duration
+	Landed    time.Time // When the effect first landed
+	Refreshed time.Time // When the effect last landed, equal to Landed until it is refreshed
+	Expires   time.Time // Zero for permanent effects
+}
+
+// Permanent returns true for effects that only end when they wear off
+func (e *ActiveEffect) Permanent() bool {
+	return e.Expires.IsZero()
+}
+
+// Remaining returns how long is left on the effect at now, -1 for permanent effects
+func (e *ActiveEffect) Remaining(now time.Time) time.Duration {
+	if e.Permanent() {
+		return -1
+	}
+	if remaining := e.Expires.Sub(now); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+var wornOffRegex = regexp.MustCompile(`^Your (.+) spell has worn off of (.+)\.$`)
+
+// BuffTracker keeps timers for every buff and debuff seen landing in a log
+type BuffTracker struct {
+	LogOwner
+	Level        int                // Log owner level, updated from level ups
+	DefaultLevel int                // Caster level assumed when the caster or their level is unknown
+	CasterLevels map[string]int     // Known levels of other casters, updated from /who output
+	Landing      *SpellLandingIndex // Recognises spells landing and fading
+
+	active map[string][]*ActiveEffect // effects keyed by target
+}
+
+// NewBuffTracker creates a tracker for the log of character at level, matching spells with landing
+func NewBuffTracker(character string, level int, landing *SpellLandingIndex) *BuffTracker {
+	return &BuffTracker{
+		LogOwner:     LogOwner{Character: character},
+		Level:        level,
+		DefaultLevel: level,
+		CasterLevels: make(map[string]int),
+		Landing:      landing,
+		active:       make(map[string][]*ActiveEffect),
+	}
+}
+
+// Add reads a log line, expiring effects that ran out before it
+func (t *BuffTracker) Add(log EqLog) {
+	t.Expire(log.T)
+	if m := wornOffRegex.FindStringSubmatch(log.Msg); m != nil {
+		t.remove(t.resolveName(m[2]), func(s Spell) bool { return strings.EqualFold(s.Name, m[1]) })
+		return
+	}
+	if t.Landing != nil {
+		if e, ok := t.Landing.Match(log); ok {
+			t.AddEvent(e)
+			return
+		}
+	}
+	if e, ok := t.parse(log); ok {
+		t.AddEvent(e)
+	}
+}
+
+// AddEvent records an already parsed event, landings start or refresh timers, fades and deaths end them
+func (t *BuffTracker) AddEvent(e Event) {
+	switch ev := e.(type) {
+	case *SpellLandedEvent:
+		t.land(ev)
+	case *SpellFadedEvent:
+		candidates := ev.Candidates
+		t.remove(t.resolveName(ev.Target), func(s Spell) bool { return containsSpell(candidates, s) })
+	case *DeathEvent:
+		delete(t.active, t.resolveName(ev.Victim))
+	case *LevelEvent:
+		t.Level = ev.Level
+	case *WhoEntryEvent:
+		if ev.Level > 0 {
+			if t.CasterLevels == nil {
+				t.CasterLevels = make(map[string]int)
+			}
+			t.CasterLevels[ev.Name] = ev.Level
+		}
+	}
+}
+
+func (t *BuffTracker) land(e *SpellLandedEvent) {
+	if t.active == nil {
+		t.active = make(map[string][]*ActiveEffect)
+	}
+	target := t.resolveName(e.Target)
+	caster := t.resolveName(e.Caster)
+	var effect *ActiveEffect
+	for _, active := range t.active[target] {
+		if containsSpell(e.Candidates, active.Spell) { // a spell sharing the message is already up, treat it as a refresh
+			effect = active
+			break
+		}
+	}
+	if effect == nil {
+		effect = &ActiveEffect{Target: target, Spell: e.Spell, Landed: e.T}
+		t.active[target] = append(t.active[target], effect)
+	}
+	effect.Refreshed = e.T
+	if caster != "" {
+		effect.Caster = caster
+	}
+	effect.Level = t.casterLevel(effect.Caster) // a refresh without a cast seen is assumed to come from the same caster
+	effect.Expires = time.Time{}
+	if d := BuffDuration(effect.Spell, effect.Level); d >= 0 {
+		effect.Expires = e.T.Add(d)
+	}
+}
+
+// Active returns every effect on target at now, soonest to expire first
+func (t *BuffTracker) Active(target string, now time.Time) []ActiveEffect {
+	var effects []ActiveEffect
+	for _, effect := range t.active[t.resolveName(target)] {
+		if effect.Permanent() || effect.Expires.After(now) {
+			effects = append(effects, *effect)
+		}
+	}
+	sortEffects(effects, now)
+	return effects
+}
+
+// Targets returns every target with an active effect
+func (t *BuffTracker) Targets() []string {
+	var targets []string
+	for target, effects := range t.active {
+		if len(effects) > 0 {
+			targets = append(targets, target)
+		}
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// Expiring returns every effect on any target ending within the next window, soonest first
+func (t *BuffTracker) Expiring(now time.Time, window time.Duration) []ActiveEffect {
+	var effects []ActiveEffect
+	for _, active := range t.active {
+		for _, effect := range active {
+			if remaining := effect.Remaining(now); remaining > 0 && remaining <= window {
+				effects = append(effects, *effect)
+			}
+		}
+	}
+	sortEffects(effects, now)
+	return effects
+}
+
+// Expire drops every effect that ended before now
+func (t *BuffTracker) Expire(now time.Time) {
+	for target, active := range t.active {
+		var kept []*ActiveEffect
+		for _, effect := range active {
+			if effect.Permanent() || effect.Expires.After(now) {
+				kept = append(kept, effect)
+			}
+		}
+		if len(kept) == 0 {
+			delete(t.active, target)
+			continue
+		}
+		t.active[target] = kept
+	}
+}
+
+func (t *BuffTracker) remove(target string, match func(Spell) bool) {
+	var kept []*ActiveEffect
+	for _, effect := range t.active[target] {
+		if !match(effect.Spell) {
+			kept = append(kept, effect)
+		}
+	}
+	if len(kept) == 0 {
+		delete(t.active, target)
+		return
+	}
+	t.active[target] = kept
+}
+
+func (t *BuffTracker) casterLevel(caster string) int {
+	if caster != "" && caster == t.Character && t.Level > 0 {
+		return t.Level
+	}
+	if level, ok := t.CasterLevels[caster]; ok {
+		return level
+	}
+	if t.DefaultLevel > 0 {
+		return t.DefaultLevel
+	}
+	return t.Level
+}
+
+func containsSpell(spells []Spell, spell Spell) bool {
+	for _, s := range spells {
+		if s.Id == spell.Id {
+			return true
+		}
+	}
+	return false
+}
+
+func sortEffects(effects []ActiveEffect, now time.Time) {
+	sort.Slice(effects, func(i, j int) bool {
+		a, b := effects[i].Remaining(now), effects[j].Remaining(now)
+		if (a < 0) != (b < 0) { // permanent effects last
+			return b < 0
+		}
+		if a != b {
+			return a < b
+		}
+		return effects[i].Spell.Name < effects[j].Spell.Name
+	})
+}
@@ -0,0 +1,99 @@
+package everquest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuffTicks(t *testing.T) {
+	tests := []struct {
+		formula  int
+		duration int
+		level    int
+		want     int
+	}{
+		{0, 0, 60, 0},
+		{1, 0, 3, 1},
+		{1, 0, 60, 30},
+		{2, 0, 60, 35},
+		{3, 0, 60, 1800},
+		{3, 270, 60, 270}, // capped by Duration
+		{5, 0, 60, 2},
+		{8, 0, 50, 60},
+		{11, 0, 60, 1890},
+		{12, 0, 7, 1},
+		{12, 0, 60, 15},
+		{15, 0, 50, 600},
+		{50, 0, 60, -1},
+		{100, 0, 60, 0},
+		{3600, 0, 60, 3600},
+	}
+	for _, test := range tests {
+		spell := Spell{Durationformula: test.formula, Duration: test.duration}
+		if got := BuffTicks(spell, test.level); got != test.want {
+			t.Fatalf("Error formula %d at level %d, got %d ticks want %d", test.formula, test.level, got, test.want)
+		}
+	}
+	if d := BuffDuration(Spell{Durationformula: 1}, 60); d != 30*BuffTick {
+		t.Fatalf("Error converting ticks to duration: %s", d)
+	}
+	if d := BuffDuration(Spell{Durationformula: 50}, 60); d != -1 {
+		t.Fatalf("Error permanent duration: %s", d)
+	}
+}
+
+func TestBuffTracker(t *testing.T) {
+	db := &SpellDB{byID: make(map[int]Spell), byName: make(map[string]int)}
+	db.byID[1] = Spell{Id: 1, Name: "Spirit of Wolf", Durationformula: 7, Shmlevel: 9,
+		Castmsg3: "You feel the spirit of wolf enter you.", Castmsg4: " feels the spirit of wolf enter them.", Castmsg5: "The spirit of wolf leaves you."}
+	db.byID[2] = Spell{Id: 2, Name: "Clarity", Durationformula: 8, Enclevel: 29,
+		Castmsg3: "A soft breeze slips through your mind.", Castmsg4: " looks very tranquil."}
+	start := time.Date(2021, time.January, 2, 20, 0, 0, 0, time.Local)
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+
+	tracker := NewBuffTracker("Mortimus", 50, NewSpellLandingIndex(db))
+	tracker.Add(EqLog{T: at(0), Msg: "[50 Warlord] Ryze (Barbarian)"})
+	tracker.Add(EqLog{T: at(0), Msg: "[20 Phantasmist] Kaijin (Erudite)"})
+	tracker.Add(EqLog{T: at(1), Msg: "You begin casting Spirit of Wolf."})
+	tracker.Add(EqLog{T: at(2), Msg: "You feel the spirit of wolf enter you."})
+	tracker.Add(EqLog{T: at(3), Msg: "Kaijin begins casting Clarity."})
+	tracker.Add(EqLog{T: at(4), Msg: "Ryze looks very tranquil."})
+
+	wolf := tracker.Active("You", at(5))
+	if len(wolf) != 1 || wolf[0].Target != "Mortimus" || wolf[0].Caster != "Mortimus" || !wolf[0].Expires.Equal(at(2).Add(50*BuffTick)) {
+		t.Fatalf("Error timing self buff at the log owner's level: %v", effectSummary(wolf))
+	}
+	clarity := tracker.Active("Ryze", at(5))
+	if len(clarity) != 1 || clarity[0].Caster != "Kaijin" || clarity[0].Level != 20 || !clarity[0].Expires.Equal(at(4).Add(30*BuffTick)) {
+		t.Fatalf("Error timing buff at the caster's /who level: %v", effectSummary(clarity))
+	}
+
+	tracker.Add(EqLog{T: at(60), Msg: "Ryze looks very tranquil."})
+	clarity = tracker.Active("Ryze", at(61))
+	if len(clarity) != 1 || !clarity[0].Landed.Equal(at(4)) || !clarity[0].Refreshed.Equal(at(60)) || !clarity[0].Expires.Equal(at(60).Add(30*BuffTick)) {
+		t.Fatalf("Error refreshing buff: %v", effectSummary(clarity))
+	}
+	if expiring := tracker.Expiring(at(61), 200*time.Second); len(expiring) != 1 || expiring[0].Target != "Ryze" {
+		t.Fatalf("Error listing expiring buffs: %v", effectSummary(expiring))
+	}
+
+	tracker.Add(EqLog{T: at(70), Msg: "Your Clarity spell has worn off of Ryze."})
+	tracker.Add(EqLog{T: at(71), Msg: "The spirit of wolf leaves you."})
+	if targets := tracker.Targets(); len(targets) != 0 {
+		t.Fatalf("Error removing worn off buffs: %v", targets)
+	}
+
+	tracker.Add(EqLog{T: at(80), Msg: "Ryze looks very tranquil."}) // no cast seen, so DefaultLevel gives 60 ticks
+	tracker.Add(EqLog{T: at(80 + 60*6 + 1), Msg: "You have entered The Plane of Knowledge."})
+	if targets := tracker.Targets(); len(targets) != 0 {
+		t.Fatalf("Error expiring buffs past their duration: %v", targets)
+	}
+}
+
+func effectSummary(effects []ActiveEffect) []string {
+	var out []string
+	for _, e := range effects {
+		out = append(out, e.Spell.Name+" on "+e.Target+" by "+e.Caster+" expires "+e.Expires.Format(time.Stamp))
+	}
+	return out
+}
@@ -0,0 +1,194 @@
+package everquest
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ChatChannel is the kind of channel a message was seen in
+type ChatChannel string
+
+const (
+	ChannelSystem     ChatChannel = "system"     // Anything that isn't chat
+	ChannelSay        ChatChannel = "say"        // Player /say
+	ChannelTell       ChatChannel = "tell"       // Private /tell
+	ChannelGuild      ChatChannel = "guild"      // /gu
+	ChannelGroup      ChatChannel = "group"      // /g
+	ChannelRaid       ChatChannel = "raid"       // /rs
+	ChannelFellowship ChatChannel = "fellowship" // /fs
+	ChannelAuction    ChatChannel = "auction"    // /auc
+	ChannelOOC        ChatChannel = "ooc"        // /ooc
+	ChannelShout      ChatChannel = "shout"      // /shout
+	ChannelEmote      ChatChannel = "emote"      // Built in socials ex: /wince
+	ChannelPet        ChatChannel = "pet"        // Pet replies ex: Gobekn told you, 'Attacking a bat Master.'
+	ChannelNPC        ChatChannel = "npc"        // NPC dialogue
+	ChannelCustom     ChatChannel = "custom"     // Joined channels ex: General:3
+)
+
+// ChatDirection is whether a message was sent or received by the log owner
+type ChatDirection string
+
+const (
+	ChatIncoming ChatDirection = "incoming"
+	ChatOutgoing ChatDirection = "outgoing"
+)
+
+// ChatMessage is a classified log message
+type ChatMessage struct {
+	Channel   ChatChannel
+	Direction ChatDirection // Empty for system messages
+	Name      string        // Custom channel name ex: Von_parses
+	Number    int           // Custom channel number, 0 if not numbered
+	Speaker   string        // Who sent the message, You for the log owner
+	Target    string        // Who a tell was sent to
+	Body      string        // Message without the quoting, the action for emotes
+}
+
+// outgoingChat maps the text before the quote of the log owner's messages to their channel
+var outgoingChat = map[string]ChatChannel{
+	"You say":                  ChannelSay,
+	"You say to your guild":    ChannelGuild,
+	"You tell your party":      ChannelGroup,
+	"You tell your raid":       ChannelRaid,
+	"You tell your fellowship": ChannelFellowship,
+	"You say out of character": ChannelOOC,
+	"You shout":                ChannelShout,
+	"You auction":              ChannelAuction,
+}
+
+// incomingChat maps the text after the speaker of received messages to their channel
+var incomingChat = []struct {
+	suffix  string
+	channel ChatChannel
+}{
+	{" tells the guild", ChannelGuild},
+	{" tells the group", ChannelGroup},
+	{" tells the raid", ChannelRaid},
+	{" tells the fellowship", ChannelFellowship},
+	{" says out of character", ChannelOOC},
+	{" tells you", ChannelTell},
+	{" told you", ChannelPet},
+	{" shouts", ChannelShout},
+	{" auctions", ChannelAuction},
+	{" says", ChannelSay},
+}
+
+var customChannelRegex = regexp.MustCompile(`^(.+?) (?:tells|tell|told) (\w+):(\d+)$`)
+
+// emoteVerbs are the built in socials, the log shows the third person form for others and this form for You
+var emoteVerbs = []string{
+	"agree", "amaze", "apologize", "applaud", "beckon", "beg", "blink", "blush", "boggle", "bonk", "bow", "burp", "cackle",
+	"calm", "cheer", "chuckle", "clap", "comfort", "congratulate", "cough", "cringe", "cry", "cuddle", "curtsey", "dance",
+	"disagree", "drool", "duck", "flex", "frown", "gasp", "giggle", "glare", "grin", "groan", "grovel", "growl", "hug",
+	"kiss", "laugh", "massage", "moan", "mourn", "nod", "nudge", "panic", "pat", "peer", "plead", "point", "poke", "ponder",
+	"pout", "purr", "puzzle", "roar", "salute", "shiver", "shrug", "sigh", "smile", "smirk", "snarl", "snicker", "sneeze",
+	"stare", "tap", "thank", "wave", "whine", "whistle", "wince", "wink", "yawn",
+}
+
+var emotes = make(map[string]bool)
+
+func init() {
+	for _, verb := range emoteVerbs {
+		emotes[verb] = true
+		emotes[thirdPerson(verb)] = true
+	}
+}
+
+// thirdPerson conjugates an emote verb for someone other than You ex: cry -> cries
+func thirdPerson(verb string) string {
+	switch {
+	case strings.HasSuffix(verb, "sh"), strings.HasSuffix(verb, "ch"), strings.HasSuffix(verb, "s"), strings.HasSuffix(verb, "x"):
+		return verb + "es"
+	case strings.HasSuffix(verb, "y") && !strings.HasSuffix(verb, "ey"):
+		return verb[:len(verb)-1] + "ies"
+	}
+	return verb + "s"
+}
+
+// ClassifyMessage works out which channel a log message belongs to, who sent it, and what was said
+func ClassifyMessage(msg string) ChatMessage {
+	msg = strings.TrimSpace(msg)
+	prefix, body, comma, ok := splitQuoted(msg)
+	if !ok {
+		return classifyEmote(msg)
+	}
+	c := ChatMessage{Body: body, Direction: ChatIncoming}
+
+	if m := customChannelRegex.FindStringSubmatch(prefix); m != nil {
+		c.Channel = ChannelCustom
+		c.Speaker = m[1]
+		c.Name = m[2]
+		c.Number, _ = strconv.Atoi(m[3])
+		if c.Speaker == "You" {
+			c.Direction = ChatOutgoing
+		}
+		return c
+	}
+
+	if strings.HasPrefix(prefix, "You ") {
+		c.Speaker = "You"
+		c.Direction = ChatOutgoing
+		if channel, ok := outgoingChat[prefix]; ok {
+			c.Channel = channel
+			return c
+		}
+		for _, verb := range []string{"You told ", "You tell "} {
+			if strings.HasPrefix(prefix, verb) {
+				c.Channel = ChannelTell
+				c.Target = strings.TrimPrefix(prefix, verb)
+				return c
+			}
+		}
+	}
+
+	for _, chat := range incomingChat {
+		if !strings.HasSuffix(prefix, chat.suffix) {
+			continue
+		}
+		c.Speaker = strings.TrimSuffix(prefix, chat.suffix)
+		c.Channel = chat.channel
+		switch {
+		case c.Speaker == "":
+			return ChatMessage{Channel: ChannelSystem, Body: msg}
+		case chat.channel == ChannelTell:
+			c.Target = "You"
+		case chat.channel == ChannelSay && (!comma || !isPlayerName(c.Speaker)): // NPCs speak without the comma
+			c.Channel = ChannelNPC
+		}
+		return c
+	}
+	return ChatMessage{Channel: ChannelSystem, Body: msg}
+}
+
+// splitQuoted splits a chat message into the text before the quote and the quoted body
+func splitQuoted(msg string) (prefix, body string, comma, ok bool) {
+	if !strings.HasSuffix(msg, "'") {
+		return "", "", false, false
+	}
+	if i := strings.Index(msg, ", '"); i > 0 && i+3 <= len(msg)-1 {
+		return msg[:i], msg[i+3 : len(msg)-1], true, true
+	}
+	if i := strings.Index(msg, " '"); i > 0 && i+2 <= len(msg)-1 {
+		return msg[:i], msg[i+2 : len(msg)-1], false, true
+	}
+	return "", "", false, false
+}
+
+// classifyEmote recognises built in socials ex: Patchouli winces. Custom /emote text can't be told apart from system messages.
+func classifyEmote(msg string) ChatMessage {
+	fields := strings.Fields(strings.TrimSuffix(msg, "."))
+	if len(fields) < 2 || !isPlayerName(fields[0]) || !emotes[fields[1]] || strings.Contains(msg, " points of ") {
+		return ChatMessage{Channel: ChannelSystem, Body: msg}
+	}
+	c := ChatMessage{
+		Channel:   ChannelEmote,
+		Direction: ChatIncoming,
+		Speaker:   fields[0],
+		Body:      strings.TrimSpace(msg[len(fields[0]):]),
+	}
+	if c.Speaker == "You" {
+		c.Direction = ChatOutgoing
+	}
+	return c
+}
@@ -0,0 +1,557 @@
+package everquest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DamageType is the kind of damage a hit was
+type DamageType string
+
+const (
+	DamageMelee DamageType = "melee"
+	DamageSpell DamageType = "spell"
+	DamageDot   DamageType = "dot"
+)
+
+// DamageEvent is any event that did damage, normalized from melee, spell and dot events
+type DamageEvent struct {
+	T        time.Time
+	Attacker string
+	Defender string
+	Damage   int
+	Type     DamageType
+	Spell    string // Spell name for spell and dot damage when known
+	Critical bool
+}
+
+// ToDamageEvent normalizes melee, spell and dot events, returning false for any other event
+func ToDamageEvent(e Event) (DamageEvent, bool) {
+	switch ev := e.(type) {
+	case *MeleeHitEvent:
+		return DamageEvent{T: ev.T, Attacker: ev.Attacker, Defender: ev.Defender, Damage: ev.Damage, Type: DamageMelee, Critical: ev.Critical()}, true
+	case *SpellDamageEvent:
+		return DamageEvent{T: ev.T, Attacker: ev.Attacker, Defender: ev.Defender, Damage: ev.Damage, Type: DamageSpell, Spell: ev.Spell, Critical: ev.Critical()}, true
+	case *DotDamageEvent:
+		return DamageEvent{T: ev.T, Attacker: ev.Attacker, Defender: ev.Defender, Damage: ev.Damage, Type: DamageDot, Spell: ev.Spell, Critical: ev.Critical()}, true
+	}
+	return DamageEvent{}, false
+}
+
+// CombatantStats totals the damage one attacker did to enemies during an encounter
+type CombatantStats struct {
+	Name   string
+	Total  int                // All damage done
+	ByType map[DamageType]int // Damage done split by melee, spell and dot
+	Hits   int                // Number of damaging hits
+	MaxHit int                // Largest single hit
+	Crits  int                // Number of critical hits
+	First  time.Time          // First damaging hit
+	Last   time.Time          // Last damaging hit
+}
+
+// Encounter is a single fight, from the first damage to an enemy until the enemies die or combat goes idle
+type Encounter struct {
+	Start       time.Time
+	End         time.Time
+	Killed      bool                       // Ended because every enemy died rather than going idle
+	Combatants  map[string]*CombatantStats // Damage done to enemies keyed by attacker
+	Enemies     map[string]int             // Damage taken keyed by enemy
+	DamageTaken map[string]int             // Damage taken by players keyed by player
+
+	alive map[string]bool
+}
+
+func newEncounter(t time.Time) *Encounter {
+	return &Encounter{
+		Start:       t,
+		End:         t,
+		Combatants:  make(map[string]*CombatantStats),
+		Enemies:     make(map[string]int),
+		DamageTaken: make(map[string]int),
+		alive:       make(map[string]bool),
+	}
+}
+
+// Name returns the enemy that took the most damage
+func (e *Encounter) Name() string {
+	var name string
+	var most int
+	for enemy, dmg := range e.Enemies {
+		if dmg > most || (dmg == most && enemy < name) {
+			name = enemy
+			most = dmg
+		}
+	}
+	return name
+}
+
+// Duration returns how long the encounter lasted, at least one second
+func (e *Encounter) Duration() time.Duration {
+	d := e.End.Sub(e.Start)
+	if d < time.Second {
+		return time.Second
+	}
+	return d
+}
+
+// Total returns all damage done to enemies
+func (e *Encounter) Total() int {
+	var total int
+	for _, c := range e.Combatants {
+		total += c.Total
+	}
+	return total
+}
+
+// DPS returns an attacker's damage per second over the whole encounter
+func (e *Encounter) DPS(name string) float64 {
+	c, ok := e.Combatants[name]
+	if !ok {
+		return 0
+	}
+	return float64(c.Total) / e.Duration().Seconds()
+}
+
+// Ranked returns every combatant sorted by total damage, highest first
+func (e *Encounter) Ranked() []CombatantStats {
+	var ranked []CombatantStats
+	for _, c := range e.Combatants {
+		ranked = append(ranked, *c)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Total == ranked[j].Total {
+			return ranked[i].Name < ranked[j].Name
+		}
+		return ranked[i].Total > ranked[j].Total
+	})
+	return ranked
+}
+
+// Summary formats the encounter like parses posted to chat
+// ex: Lord Vyemm in 485s, 249k AH | Kaijin 22042 AH | Voltha 18485 AH
+func (e *Encounter) Summary(label string) string {
+	suffix := ""
+	if label != "" {
+		suffix = " " + label
+	}
+	parts := []string{fmt.Sprintf("%s in %ds, %s%s", e.Name(), int(e.Duration().Seconds()), abbreviateNumber(e.Total()), suffix)}
+	for _, c := range e.Ranked() {
+		parts = append(parts, fmt.Sprintf("%s %d%s", c.Name, c.Total, suffix))
+	}
+	return strings.Join(parts, " | ")
+}
+
+// addDamage records a hit on an enemy, damage with no known attacker only counts towards the enemy
+func (e *Encounter) addDamage(d DamageEvent) {
+	e.extend(d.T)
+	e.Enemies[d.Defender] += d.Damage
+	e.alive[d.Defender] = true
+	if d.Attacker == "" {
+		return
+	}
+	c, ok := e.Combatants[d.Attacker]
+	if !ok {
+		c = &CombatantStats{Name: d.Attacker, ByType: make(map[DamageType]int), First: d.T, Last: d.T}
+		e.Combatants[d.Attacker] = c
+	}
+	c.Total += d.Damage
+	c.ByType[d.Type] += d.Damage
+	c.Hits++
+	if d.Damage > c.MaxHit {
+		c.MaxHit = d.Damage
+	}
+	if d.Critical {
+		c.Crits++
+	}
+	if d.T.Before(c.First) {
+		c.First = d.T
+	}
+	if d.T.After(c.Last) {
+		c.Last = d.T
+	}
+}
+
+// extend widens the encounter to cover t, hits held until their sides were known can be older than the start
+func (e *Encounter) extend(t time.Time) {
+	if t.Before(e.Start) {
+		e.Start = t
+	}
+	if t.After(e.End) {
+		e.End = t
+	}
+}
+
+// side is which side of a fight a name is on
+type side int
+
+const (
+	sideUnknown side = iota
+	sideFriend
+	sideEnemy
+)
+
+// EncounterTracker splits a stream of logs into encounters.
+// Enemies are told apart from friends by how names are used: the log owner, the raid roster, known pets and
+// people talking in tells, group, raid or guild are friends, whoever they hit is an enemy and whoever hits them
+// is an enemy. Hits between two names whose sides aren't known yet are held until a later line decides them,
+// or until a death or the end of the encounter forces a best guess.
+type EncounterTracker struct {
+	LogOwner
+	IdleTimeout   time.Duration    // Time without damage that ends an encounter, defaults to 30 seconds
+	OnEncounter   func(*Encounter) // Called whenever an encounter ends, may be nil
+	Pets          *PetTracker      // Rolls pet damage up under the owner when set, learning pets from the logs passed to Add
+	Raid          *Raid            // Roster of friendly players, may be nil
+	NonMeleeOwner bool             // Credit "was hit by non-melee" damage to the log owner, the same line shows other players' damage shields and procs
+
+	sides      map[string]side // learned sides keyed by lower case name
+	pending    []DamageEvent   // hits between names whose sides aren't known yet
+	current    *Encounter
+	encounters []*Encounter
+}
+
+// NewEncounterTracker creates a tracker for the log of character
+func NewEncounterTracker(character string) *EncounterTracker {
+	return &EncounterTracker{
+		LogOwner:    LogOwner{Character: character},
+		IdleTimeout: 30 * time.Second,
+	}
+}
+
+// Add parses a log and adds it to the current encounter
+func (t *EncounterTracker) Add(log EqLog) {
+	t.Observe(log)
+	if e, ok := t.parse(log); ok {
+		t.AddEvent(e)
+	}
+}
+
+// Observe learns pets and friends from a log without parsing it for damage, Add calls it.
+// Use it alongside AddEvent when logs are parsed elsewhere, ex: by an EventDispatcher.
+func (t *EncounterTracker) Observe(log EqLog) {
+	if t.Pets != nil {
+		t.Pets.Add(log)
+	}
+	chat := ClassifyMessage(log.Msg)
+	switch chat.Channel {
+	case ChannelTell, ChannelGroup, ChannelRaid, ChannelGuild, ChannelFellowship:
+		if chat.Direction == ChatIncoming {
+			t.Learn(chat.Speaker, true)
+		}
+	}
+}
+
+// AddEvent adds an already parsed event, ignoring anything that isn't damage, a death or a /who entry
+func (t *EncounterTracker) AddEvent(e Event) {
+	switch ev := e.(type) {
+	case *DeathEvent:
+		t.addDeath(ev)
+		return
+	case *WhoEntryEvent:
+		t.Learn(ev.Name, true)
+		return
+	}
+	d, ok := ToDamageEvent(e)
+	if !ok {
+		return
+	}
+	d.Attacker = t.resolveName(d.Attacker)
+	d.Defender = t.resolveName(d.Defender)
+	if d.Attacker == "" && t.NonMeleeOwner {
+		d.Attacker = t.resolveName("You")
+	}
+	t.CheckIdle(d.T)
+	t.addDamage(d)
+}
+
+// Learn records which side a name is on, friend true for players on the log owner's side
+func (t *EncounterTracker) Learn(name string, friend bool) {
+	if name == "" {
+		return
+	}
+	s := sideEnemy
+	if friend {
+		s = sideFriend
+	}
+	if t.sideOf(name) == s {
+		return
+	}
+	if t.sides == nil {
+		t.sides = make(map[string]side)
+	}
+	t.sides[strings.ToLower(name)] = s
+	t.retryPending()
+}
+
+// Friendly returns true if name is known to be on the log owner's side, false for enemies and names not seen fighting yet
+func (t *EncounterTracker) Friendly(name string) bool {
+	return t.sideOf(t.resolveName(name)) == sideFriend
+}
+
+// CheckIdle ends the current encounter if nothing has happened since IdleTimeout before now
+func (t *EncounterTracker) CheckIdle(now time.Time) {
+	timeout := t.IdleTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	last := time.Time{}
+	if t.current != nil {
+		last = t.current.End
+	}
+	if n := len(t.pending); n > 0 && t.pending[n-1].T.After(last) {
+		last = t.pending[n-1].T
+	}
+	if !last.IsZero() && now.Sub(last) > timeout {
+		t.Flush()
+	}
+}
+
+// Flush ends the current encounter, deciding any hits still waiting on their sides
+func (t *EncounterTracker) Flush() {
+	t.guessPending()
+	if t.current != nil {
+		t.finish()
+	}
+}
+
+// Current returns the encounter in progress, nil if there isn't one
+func (t *EncounterTracker) Current() *Encounter {
+	return t.current
+}
+
+// Encounters returns every finished encounter in order
+func (t *EncounterTracker) Encounters() []*Encounter {
+	return t.encounters
+}
+
+// Run adds every log from in until it is closed, then flushes the last encounter
+func (t *EncounterTracker) Run(in <-chan EqLog) {
+	for log := range in {
+		t.Add(log)
+	}
+	t.Flush()
+}
+
+// addDamage works out which side of a hit is the enemy, holding the hit back if that isn't known yet
+func (t *EncounterTracker) addDamage(d DamageEvent) {
+	if t.Pets != nil {
+		d.Attacker = t.resolvePet(d.Attacker)
+		d.Defender = t.resolvePet(d.Defender)
+	}
+	attacker, defender := t.sideOf(d.Attacker), t.sideOf(d.Defender)
+	if attacker == sideUnknown && defender == sideUnknown {
+		switch {
+		case d.Defender != "" && !isPlayerName(d.Defender): // players can't have this name, so it is an npc
+			defender = sideEnemy
+		case d.Attacker != "" && !isPlayerName(d.Attacker):
+			attacker = sideEnemy
+		default:
+			t.pending = append(t.pending, d)
+			return
+		}
+	}
+	var learned bool
+	switch {
+	case attacker == defender: // friendly fire, or npcs fighting each other
+		return
+	case attacker == sideFriend || defender == sideEnemy:
+		learned = t.learnSide(d.Attacker, sideFriend) || learned
+		learned = t.learnSide(d.Defender, sideEnemy) || learned
+		t.hitEnemy(d)
+	default:
+		learned = t.learnSide(d.Attacker, sideEnemy) || learned
+		learned = t.learnSide(d.Defender, sideFriend) || learned
+		if t.current != nil { // an enemy hitting a player doesn't start a fight on its own
+			t.current.extend(d.T)
+			t.current.DamageTaken[d.Defender] += d.Damage
+		}
+	}
+	if learned {
+		t.retryPending()
+	}
+}
+
+func (t *EncounterTracker) hitEnemy(d DamageEvent) {
+	if t.current == nil {
+		t.current = newEncounter(d.T)
+	}
+	t.current.addDamage(d)
+}
+
+// learnSide records the side of a name not seen before without retrying held hits, returning true if it was new
+func (t *EncounterTracker) learnSide(name string, s side) bool {
+	if name == "" || t.sideOf(name) != sideUnknown {
+		return false
+	}
+	if t.sides == nil {
+		t.sides = make(map[string]side)
+	}
+	t.sides[strings.ToLower(name)] = s
+	return true
+}
+
+// retryPending re-adds held hits now that more sides are known
+func (t *EncounterTracker) retryPending() {
+	for {
+		pending := t.pending
+		t.pending = nil
+		for _, d := range pending {
+			t.addDamage(d)
+		}
+		if len(t.pending) == len(pending) {
+			return
+		}
+	}
+}
+
+// guessPending decides every held hit. Names hitting each other are split into two sides and the smaller side,
+// usually the one npc many players are fighting, is taken to be the enemy. Even splits fall back on the
+// defender of the first hit. Hits with no attacker, ex: damage shields and dots, never decide a side, they are
+// placed once the sides are known and dropped if nothing else places them.
+func (t *EncounterTracker) guessPending() {
+	for len(t.pending) > 0 {
+		first := -1
+		for i, d := range t.pending {
+			if d.Attacker != "" {
+				first = i
+				break
+			}
+		}
+		if first < 0 {
+			t.pending = nil
+			return
+		}
+		group := map[string]bool{strings.ToLower(t.pending[first].Defender): true, strings.ToLower(t.pending[first].Attacker): false}
+		for changed := true; changed; { // spread the two sides across every hit connected to the first
+			changed = false
+			for _, d := range t.pending {
+				if d.Attacker == "" {
+					continue
+				}
+				a, aok := group[strings.ToLower(d.Attacker)]
+				b, bok := group[strings.ToLower(d.Defender)]
+				switch {
+				case aok && !bok:
+					group[strings.ToLower(d.Defender)] = !a
+					changed = true
+				case bok && !aok:
+					group[strings.ToLower(d.Attacker)] = !b
+					changed = true
+				}
+			}
+		}
+		var defenders, attackers int
+		for _, isDefenderSide := range group {
+			if isDefenderSide {
+				defenders++
+			} else {
+				attackers++
+			}
+		}
+		enemy := true // the first defender's side
+		if attackers > 0 && attackers < defenders {
+			enemy = false
+		}
+		for name, isDefenderSide := range group {
+			if isDefenderSide == enemy {
+				t.learnSide(name, sideEnemy)
+			} else {
+				t.learnSide(name, sideFriend)
+			}
+		}
+		t.retryPending()
+	}
+}
+
+// sideOf returns what is known about a name, the log owner and raid members are always friends
+func (t *EncounterTracker) sideOf(name string) side {
+	if name == "" {
+		return sideUnknown
+	}
+	if name == "You" || (t.Character != "" && strings.EqualFold(name, t.Character)) {
+		return sideFriend
+	}
+	if s, ok := t.sides[strings.ToLower(name)]; ok {
+		return s
+	}
+	if t.Raid != nil {
+		for _, member := range t.Raid.Members {
+			if strings.EqualFold(member.Player, name) {
+				return sideFriend
+			}
+		}
+	}
+	return sideUnknown
+}
+
+// resolvePet returns a pet's owner, marking the owner as a friend since player pets fight on the players' side
+func (t *EncounterTracker) resolvePet(name string) string {
+	owner, ok := t.Pets.Owner(name)
+	if !ok {
+		return name
+	}
+	t.learnSide(owner, sideFriend)
+	return owner
+}
+
+func (t *EncounterTracker) addDeath(death *DeathEvent) {
+	if t.Pets != nil && t.Pets.Known(death.Victim) { // a dead pet's name may be reused by someone else's pet
+		t.Pets.AddEvent(death)
+		return
+	}
+	victim := t.resolveName(death.Victim)
+	for _, d := range t.pending {
+		if strings.EqualFold(d.Defender, victim) || strings.EqualFold(d.Attacker, victim) { // a death ends the wait to find out who was fighting whom
+			t.guessPending()
+			break
+		}
+	}
+	if t.current == nil || !t.current.alive[victim] {
+		return
+	}
+	delete(t.current.alive, victim)
+	t.current.extend(death.T)
+	if len(t.current.alive) == 0 {
+		t.current.Killed = true
+		t.finish()
+	}
+}
+
+func (t *EncounterTracker) finish() {
+	e := t.current
+	t.current = nil
+	t.encounters = append(t.encounters, e)
+	if t.OnEncounter != nil {
+		t.OnEncounter(e)
+	}
+}
+
+// isPlayerName returns false for names no player could have, more than one word or not capitalized, so they must belong to npcs.
+// A single capitalized word may be either and is only decided by how the name is used.
+func isPlayerName(name string) bool {
+	if name == "You" {
+		return true
+	}
+	if name == "" || name[0] < 'A' || name[0] > 'Z' {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// abbreviateNumber shortens large numbers ex: 249312 -> 249k
+func abbreviateNumber(n int) string {
+	switch {
+	case n >= 1000000:
+		return fmt.Sprintf("%.1fm", float64(n)/1000000)
+	case n >= 1000:
+		return fmt.Sprintf("%dk", n/1000)
+	}
+	return fmt.Sprintf("%d", n)
+}
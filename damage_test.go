@@ -0,0 +1,86 @@
+package everquest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEncounterTracker(t *testing.T) {
+	start := time.Date(2021, time.January, 2, 20, 0, 0, 0, time.Local)
+	lines := []struct {
+		offset int
+		msg    string
+	}{
+		{0, "Kaijin slashes Lord Vyemm for 500 points of damage."},
+		{1, "You hit Lord Vyemm for 1200 points of fire damage by Ice Comet. (Critical)"},
+		{2, "Lord Vyemm bites Kaijin for 300 points of damage."},
+		{3, "Lord Vyemm has taken 200 damage from your Splurt."},
+		{4, "Lord Vyemm has been slain by Kaijin!"},
+		{100, "Kaijin slashes a gnoll for 50 points of damage."},
+	}
+	tracker := NewEncounterTracker("Voltha")
+	for _, line := range lines {
+		tracker.Add(EqLog{T: start.Add(time.Duration(line.offset) * time.Second), Msg: line.msg})
+	}
+	tracker.Flush()
+
+	encounters := tracker.Encounters()
+	if len(encounters) != 2 {
+		t.Fatalf("Error splitting encounters, got %d", len(encounters))
+	}
+	vyemm := encounters[0]
+	if !vyemm.Killed || vyemm.Name() != "Lord Vyemm" || vyemm.Total() != 1900 {
+		t.Fatalf("Error tracking encounter: killed %v name %s total %d", vyemm.Killed, vyemm.Name(), vyemm.Total())
+	}
+	voltha := vyemm.Combatants["Voltha"]
+	if voltha == nil || voltha.Total != 1400 || voltha.Crits != 1 || voltha.MaxHit != 1200 {
+		t.Fatalf("Error attributing damage to log owner: %+v", voltha)
+	}
+	if vyemm.DamageTaken["Kaijin"] != 300 {
+		t.Fatalf("Error tracking damage taken")
+	}
+	if summary := vyemm.Summary("AH"); summary != "Lord Vyemm in 4s, 1k AH | Voltha 1400 AH | Kaijin 500 AH" {
+		t.Fatalf("Error formatting summary: %s", summary)
+	}
+}
+
+func TestEncounterTrackerSides(t *testing.T) {
+	start := time.Date(2021, time.January, 2, 20, 0, 0, 0, time.Local)
+	tracker := NewEncounterTracker("Voltha")
+	tracker.Add(EqLog{T: start, Msg: "Kaijin slashes Trakanon for 500 points of damage."})
+	tracker.Add(EqLog{T: start.Add(time.Second), Msg: "Trakanon was hit by non-melee for 40 points of damage."})
+	tracker.Add(EqLog{T: start.Add(2 * time.Second), Msg: "Trakanon has been slain by Kaijin!"})
+	encounters := tracker.Encounters()
+	if len(encounters) != 1 || !encounters[0].Killed || encounters[0].Name() != "Trakanon" {
+		t.Fatalf("Error treating a single word npc as an enemy: %+v", encounters)
+	}
+	if encounters[0].Combatants["Kaijin"] == nil || encounters[0].Combatants["Voltha"] != nil || encounters[0].Enemies["Trakanon"] != 540 {
+		t.Fatalf("Error attributing damage: %+v %+v", encounters[0].Combatants, encounters[0].Enemies)
+	}
+
+	tracker = NewEncounterTracker("Voltha")
+	tracker.Add(EqLog{T: start, Msg: "Kaijin was hit by non-melee for 40 points of damage."})
+	tracker.Flush()
+	if len(tracker.Encounters()) != 0 || tracker.sideOf("Kaijin") != sideUnknown {
+		t.Fatalf("Error deciding sides from a lone non-melee hit: %+v", tracker.Encounters())
+	}
+	tracker.Add(EqLog{T: start.Add(time.Second), Msg: "Kaijin was hit by non-melee for 40 points of damage."})
+	tracker.Add(EqLog{T: start.Add(2 * time.Second), Msg: "Kaijin slashes Trakanon for 500 points of damage."})
+	tracker.Add(EqLog{T: start.Add(3 * time.Second), Msg: "Trakanon has been slain by Kaijin!"})
+	encounters = tracker.Encounters()
+	if len(encounters) != 1 || encounters[0].Name() != "Trakanon" || encounters[0].Combatants["Kaijin"] == nil {
+		t.Fatalf("Error letting a non-melee hit on a player decide the enemy: %+v", encounters)
+	}
+
+	raid := &Raid{Members: []RaidMember{{Player: "Kaijin"}, {Player: "Voltha"}}}
+	tracker = NewEncounterTracker("Voltha")
+	tracker.Raid = raid
+	tracker.Add(EqLog{T: start, Msg: "Innoruuk hits Kaijin for 900 points of damage."})
+	tracker.Add(EqLog{T: start.Add(time.Second), Msg: "Kaijin slashes Innoruuk for 300 points of damage."})
+	tracker.Add(EqLog{T: start.Add(2 * time.Second), Msg: "Innoruuk hits Kaijin for 800 points of damage."})
+	tracker.Flush()
+	encounters = tracker.Encounters()
+	if len(encounters) != 1 || encounters[0].Enemies["Innoruuk"] != 300 || encounters[0].DamageTaken["Kaijin"] != 800 {
+		t.Fatalf("Error using the raid roster to pick sides: %+v", encounters)
+	}
+}
@@ -0,0 +1,199 @@
+package everquest
+
+import (
+	"strings"
+	"time"
+)
+
+// DeathRecord is a death along with the damage taken leading up to it
+type DeathRecord struct {
+	T      time.Time
+	Victim string
+	Killer string        // Empty if the log does not say
+	Damage []DamageEvent // Last damage taken before dying, oldest first
+}
+
+// Wipe is a large share of the raid dying within a short window
+type Wipe struct {
+	Start    time.Time
+	End      time.Time
+	Deaths   []DeathRecord // Raid member deaths making up the wipe, later deaths within the window are added as they happen
+	RaidSize int           // Raid members at the time of the wipe
+}
+
+// damageRing keeps the last n damage events taken by one target
+type damageRing struct {
+	events []DamageEvent
+	next   int
+	full   bool
+}
+
+func (r *damageRing) add(d DamageEvent) {
+	r.events[r.next] = d
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// ordered returns the kept events oldest first
+func (r *damageRing) ordered() []DamageEvent {
+	if !r.full {
+		return append([]DamageEvent(nil), r.events[:r.next]...)
+	}
+	return append(append([]DamageEvent(nil), r.events[r.next:]...), r.events[:r.next]...)
+}
+
+// DeathTracker records deaths with their recent damage and spots raid wipes
+type DeathTracker struct {
+	LogOwner
+	History      int               // Damage events kept per target, defaults to 10
+	Raid         *Raid             // Current roster used for wipe detection, nil disables it
+	WipeFraction float64           // Share of the raid that must die to count as a wipe, defaults to half
+	WipeWindow   time.Duration     // How close together the deaths must be, defaults to a minute
+	OnDeath      func(DeathRecord) // Called for every death, may be nil
+	OnWipe       func(Wipe)        // Called once when a wipe is detected, may be nil
+
+	recent map[string]*damageRing
+	deaths []DeathRecord
+	wipes  []*Wipe
+}
+
+// NewDeathTracker creates a tracker for the log of character, detecting wipes against raid
+func NewDeathTracker(character string, raid *Raid) *DeathTracker {
+	return &DeathTracker{
+		LogOwner:     LogOwner{Character: character},
+		History:      10,
+		Raid:         raid,
+		WipeFraction: 0.5,
+		WipeWindow:   time.Minute,
+	}
+}
+
+// Add parses a log and records it if it is damage or a death
+func (t *DeathTracker) Add(log EqLog) {
+	if e, ok := t.parse(log); ok {
+		t.AddEvent(e)
+	}
+}
+
+// AddEvent records an already parsed event, ignoring anything that isn't damage or a death
+func (t *DeathTracker) AddEvent(e Event) {
+	if death, ok := e.(*DeathEvent); ok {
+		t.addDeath(death)
+		return
+	}
+	d, ok := ToDamageEvent(e)
+	if !ok {
+		return
+	}
+	d.Attacker = t.resolveName(d.Attacker)
+	d.Defender = t.resolveName(d.Defender)
+	if t.recent == nil {
+		t.recent = make(map[string]*damageRing)
+	}
+	ring, ok := t.recent[d.Defender]
+	if !ok {
+		history := t.History
+		if history <= 0 {
+			history = 10
+		}
+		ring = &damageRing{events: make([]DamageEvent, history)}
+		t.recent[d.Defender] = ring
+	}
+	ring.add(d)
+}
+
+// Deaths returns every recorded death in order
+func (t *DeathTracker) Deaths() []DeathRecord {
+	return t.deaths
+}
+
+// DeathsOf returns every recorded death of one victim
+func (t *DeathTracker) DeathsOf(name string) []DeathRecord {
+	var results []DeathRecord
+	for _, death := range t.deaths {
+		if strings.EqualFold(death.Victim, name) {
+			results = append(results, death)
+		}
+	}
+	return results
+}
+
+// Wipes returns every detected wipe in order
+func (t *DeathTracker) Wipes() []Wipe {
+	var wipes []Wipe
+	for _, wipe := range t.wipes {
+		wipes = append(wipes, *wipe)
+	}
+	return wipes
+}
+
+func (t *DeathTracker) addDeath(e *DeathEvent) {
+	victim := t.resolveName(e.Victim)
+	death := DeathRecord{T: e.T, Victim: victim, Killer: t.resolveName(e.Killer)}
+	if ring, ok := t.recent[victim]; ok {
+		death.Damage = ring.ordered()
+		delete(t.recent, victim)
+	}
+	t.deaths = append(t.deaths, death)
+	if t.OnDeath != nil {
+		t.OnDeath(death)
+	}
+	t.checkWipe(death)
+}
+
+// checkWipe extends a wipe in progress or starts one when enough of the raid has died within the window
+func (t *DeathTracker) checkWipe(death DeathRecord) {
+	if t.Raid == nil || len(t.Raid.Members) == 0 || !t.inRaid(death.Victim) {
+		return
+	}
+	window := t.WipeWindow
+	if window <= 0 {
+		window = time.Minute
+	}
+	if len(t.wipes) > 0 {
+		if wipe := t.wipes[len(t.wipes)-1]; death.T.Sub(wipe.End) <= window {
+			wipe.Deaths = append(wipe.Deaths, death)
+			wipe.End = death.T
+			return
+		}
+	}
+
+	var recent []DeathRecord
+	dead := make(map[string]bool)
+	for i := len(t.deaths) - 1; i >= 0; i-- {
+		d := t.deaths[i]
+		if death.T.Sub(d.T) > window {
+			break
+		}
+		if len(t.wipes) > 0 && !d.T.After(t.wipes[len(t.wipes)-1].End) { // already part of the last wipe
+			break
+		}
+		if t.inRaid(d.Victim) && !dead[strings.ToLower(d.Victim)] {
+			dead[strings.ToLower(d.Victim)] = true
+			recent = append([]DeathRecord{d}, recent...)
+		}
+	}
+	fraction := t.WipeFraction
+	if fraction <= 0 {
+		fraction = 0.5
+	}
+	if float64(len(dead)) < fraction*float64(len(t.Raid.Members)) {
+		return
+	}
+	wipe := &Wipe{Start: recent[0].T, End: death.T, Deaths: recent, RaidSize: len(t.Raid.Members)}
+	t.wipes = append(t.wipes, wipe)
+	if t.OnWipe != nil {
+		t.OnWipe(*wipe)
+	}
+}
+
+func (t *DeathTracker) inRaid(name string) bool {
+	for _, member := range t.Raid.Members {
+		if strings.EqualFold(member.Player, name) {
+			return true
+		}
+	}
+	return false
+}
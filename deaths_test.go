@@ -0,0 +1,45 @@
+package everquest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeathTrackerWipes(t *testing.T) {
+	raid := &Raid{Members: []RaidMember{{Player: "Mortimus"}, {Player: "Kaijin"}, {Player: "Ryze"}, {Player: "Voltha"}}}
+	start := time.Date(2021, time.January, 2, 20, 0, 0, 0, time.Local)
+	lines := []struct {
+		offset int
+		msg    string
+	}{
+		{0, "Lord Vyemm bites Kaijin for 300 points of damage."},
+		{1, "Kaijin has been slain by Lord Vyemm!"},
+		{2, "a skeleton has been slain by Ryze!"}, // not in the raid
+		{120, "Ryze has been slain by Lord Vyemm!"},
+		{150, "You have been slain by Lord Vyemm!"},   // half the raid within a minute
+		{200, "Voltha has been slain by Lord Vyemm!"}, // within a minute of the last death, extends the wipe
+		{400, "Kaijin has been slain by a skeleton!"}, // a new wipe needs half the raid again
+	}
+	var wiped int
+	tracker := NewDeathTracker("Mortimus", raid)
+	tracker.OnWipe = func(Wipe) { wiped++ }
+	for _, line := range lines {
+		tracker.Add(EqLog{T: start.Add(time.Duration(line.offset) * time.Second), Msg: line.msg})
+	}
+
+	if deaths := tracker.Deaths(); len(deaths) != 6 {
+		t.Fatalf("Error recording deaths, got %d", len(deaths))
+	}
+	kaijin := tracker.DeathsOf("kaijin")
+	if len(kaijin) != 2 || kaijin[0].Killer != "Lord Vyemm" || len(kaijin[0].Damage) != 1 || kaijin[0].Damage[0].Damage != 300 {
+		t.Fatalf("Error keeping damage before death: %+v", kaijin)
+	}
+	wipes := tracker.Wipes()
+	if len(wipes) != 1 || wiped != 1 {
+		t.Fatalf("Error detecting wipes, got %d called %d times", len(wipes), wiped)
+	}
+	wipe := wipes[0]
+	if len(wipe.Deaths) != 3 || wipe.Deaths[1].Victim != "Mortimus" || !wipe.Start.Equal(start.Add(120*time.Second)) || !wipe.End.Equal(start.Add(200*time.Second)) || wipe.RaidSize != 4 {
+		t.Fatalf("Error building wipe: %+v", wipe)
+	}
+}
@@ -0,0 +1,500 @@
+package everquest
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EventType identifies what kind of log line an Event was parsed from
+type EventType string
+
+const (
+	EventMeleeHit    EventType = "melee hit"
+	EventSpellDamage EventType = "spell damage"
+	EventDotDamage   EventType = "dot damage"
+	EventHeal        EventType = "heal"
+	EventLoot        EventType = "loot"
+	EventZone        EventType = "zone"
+	EventLevel       EventType = "level"
+	EventExperience  EventType = "experience"
+	EventAAPoint     EventType = "aa point"
+	EventDeath       EventType = "death"
+	EventTell        EventType = "tell"
+	EventWhoEntry    EventType = "who entry"
+	EventDieRolled   EventType = "die rolled"
+	EventRollResult  EventType = "roll result"
+	EventSpellLanded EventType = "spell landed"
+	EventSpellFaded  EventType = "spell faded"
+)
+
+// Event is a typed representation of a single EqLog line
+type Event interface {
+	Type() EventType // What kind of event this is
+	Line() EqLog     // The log line the event was parsed from
+}
+
+// Line returns the log itself, letting event structs embed EqLog to satisfy Event
+func (l EqLog) Line() EqLog {
+	return l
+}
+
+// MeleeHitEvent is a successful melee attack ex: Xibab slashes a cave bear for 45 points of damage.
+type MeleeHitEvent struct {
+	EqLog
+	Attacker  string // Who landed the hit, You if the log owner
+	Verb      string // hits, slashes, bites, etc
+	Defender  string // Who was hit, You if the log owner
+	Damage    int    // Damage done
+	Modifiers string // Parenthesised suffix like Critical or Riposte, if any
+}
+
+func (e *MeleeHitEvent) Type() EventType { return EventMeleeHit }
+
+// Critical reports whether the hit was flagged as a critical or crippling blow
+func (e *MeleeHitEvent) Critical() bool {
+	return isCritical(e.Modifiers)
+}
+
+// SpellDamageEvent is direct non-melee damage ex: You hit a cave bear for 1200 points of fire damage by Ice Comet.
+type SpellDamageEvent struct {
+	EqLog
+	Attacker   string // Who cast the spell, empty if the log does not say
+	Defender   string // Who took the damage
+	Damage     int    // Damage done
+	DamageType string // fire, cold, magic, etc - empty for the old non-melee message
+	Spell      string // Spell name, empty if the log does not say
+	Modifiers  string // Parenthesised suffix like Critical, if any
+}
+
+func (e *SpellDamageEvent) Type() EventType { return EventSpellDamage }
+
+// Critical reports whether the spell was flagged as a critical blast
+func (e *SpellDamageEvent) Critical() bool {
+	return isCritical(e.Modifiers)
+}
+
+// DotDamageEvent is a damage over time tick ex: a cave bear has taken 300 damage from your Splurt.
+type DotDamageEvent struct {
+	EqLog
+	Attacker  string // Who cast the dot, You if the log owner
+	Defender  string // Who took the damage
+	Damage    int    // Damage done
+	Spell     string // Spell name
+	Modifiers string // Parenthesised suffix like Critical, if any
+}
+
+func (e *DotDamageEvent) Type() EventType { return EventDotDamage }
+
+// Critical reports whether the tick was flagged as a critical
+func (e *DotDamageEvent) Critical() bool {
+	return isCritical(e.Modifiers)
+}
+
+// HealEvent is a heal landing ex: Xibab healed you for 1200 (1500) hit points by Complete Heal.
+type HealEvent struct {
+	EqLog
+	Healer    string // Who cast the heal, empty if the log does not say
+	Target    string // Who was healed
+	Amount    int    // Hit points actually restored
+	Full      int    // Hit points the heal could have restored, 0 if the log does not say
+	Spell     string // Spell name, empty if the log does not say
+	OverTime  bool   // Heal over time tick
+	Modifiers string // Parenthesised suffix like Critical, if any
+}
+
+func (e *HealEvent) Type() EventType { return EventHeal }
+
+// LootEvent is an item being looted ex: --Xibab has looted a Shawl of Perception from Lord Vyemm's corpse.--
+type LootEvent struct {
+	EqLog
+	Looter string // Who looted the item, You if the log owner
+	Item   string // Item name
+	Count  int    // Number of items looted
+	Corpse string // Whose corpse the item came from without the 's corpse suffix, empty if the log does not say
+	Giver  string // Master looter who handed out the item, empty for a normal loot
+}
+
+func (e *LootEvent) Type() EventType { return EventLoot }
+
+// ZoneEvent is the log owner changing zones ex: You have entered The Plane of Knowledge.
+type ZoneEvent struct {
+	EqLog
+	Zone string // Full zone name
+}
+
+func (e *ZoneEvent) Type() EventType { return EventZone }
+
+// LevelEvent is the log owner gaining or losing a level ex: You have gained a level! Welcome to level 60!
+type LevelEvent struct {
+	EqLog
+	Level int  // New level
+	Lost  bool // True if the level was lost instead of gained
+}
+
+func (e *LevelEvent) Type() EventType { return EventLevel }
+
+// ExperienceEvent is the log owner gaining experience from a kill ex: You gain party experience!!
+type ExperienceEvent struct {
+	EqLog
+	Share   string  // party or raid for shared experience, empty for solo
+	Percent float64 // Percent of a level gained when the client shows it, 0 otherwise
+}
+
+func (e *ExperienceEvent) Type() EventType { return EventExperience }
+
+// AAPointEvent is the log owner earning alternate advancement points ex: You have gained an ability point!  You now have 5 ability points.
+type AAPointEvent struct {
+	EqLog
+	Points int // Points just earned
+	Total  int // Unspent points after earning them, 0 if the log does not say
+}
+
+func (e *AAPointEvent) Type() EventType { return EventAAPoint }
+
+// DeathEvent is something dying ex: Xibab has been slain by Lord Vyemm!
+type DeathEvent struct {
+	EqLog
+	Victim string // Who died, You if the log owner
+	Killer string // Who killed them, empty if the log does not say
+}
+
+func (e *DeathEvent) Type() EventType { return EventDeath }
+
+// TellEvent is a private message to or from the log owner
+type TellEvent struct {
+	EqLog
+	From     string // Sender, You if outgoing
+	To       string // Recipient, You if incoming
+	Text     string // Message body without quotes
+	Outgoing bool   // Sent by the log owner
+}
+
+func (e *TellEvent) Type() EventType { return EventTell }
+
+// WhoEntryEvent is a single player line of /who output ex: [60 Grave Lord] Xibab (Iksar) <Guild> ZONE: potimea
+type WhoEntryEvent struct {
+	EqLog
+	Name      string // Character name
+	Level     int    // Character level, 0 if anonymous
+	Title     string // Class or class title as shown, empty if anonymous
+	Race      string // Character race, empty if anonymous
+	Guild     string // Guild name, empty if unguilded
+	Zone      string // Zone short name, empty if not shown
+	Class     string // Full class name resolved from Title, empty if anonymous or unknown
+	Anonymous bool   // Character is /anon
+	Roleplay  bool   // Character is /roleplay
+	LFG       bool   // Character is looking for group
+	AFK       bool   // Character is away from keyboard
+	LinkDead  bool   // Character is linkdead
+}
+
+func (e *WhoEntryEvent) Type() EventType { return EventWhoEntry }
+
+// DieRolledEvent is the first line of a /random ex: **A Magic Die is rolled by Xibab.
+type DieRolledEvent struct {
+	EqLog
+	Roller string // Who rolled
+}
+
+func (e *DieRolledEvent) Type() EventType { return EventDieRolled }
+
+// RollResultEvent is the second line of a /random ex: **It could have been any number from 0 to 100, but this time it turned up a 42.
+type RollResultEvent struct {
+	EqLog
+	Min    int // Lowest possible roll
+	Max    int // Highest possible roll
+	Result int // Actual roll
+}
+
+func (e *RollResultEvent) Type() EventType { return EventRollResult }
+
+// SpellLandedEvent is a spell taking hold, recognised from its cast on you or cast on other message ex: a cave bear is slowed.
+// Many spells share a message so every possible spell is kept, see SpellLandingIndex.
+type SpellLandedEvent struct {
+	EqLog
+	Target     string  // Who the spell landed on, You if the log owner
+	Caster     string  // Who was last seen casting the spell, empty if unknown
+	Spell      Spell   // Most likely spell
+	Candidates []Spell // Every spell with this message, most likely first
+}
+
+func (e *SpellLandedEvent) Type() EventType { return EventSpellLanded }
+
+// SpellFadedEvent is a spell wearing off the log owner ex: Your skin returns to normal.
+type SpellFadedEvent struct {
+	EqLog
+	Target     string  // Who the spell faded from, You if the log owner
+	Spell      Spell   // Most likely spell
+	Candidates []Spell // Every spell with this message, most likely first
+}
+
+func (e *SpellFadedEvent) Type() EventType { return EventSpellFaded }
+
+// EventMatcher turns log lines matching Regex into typed events
+type EventMatcher struct {
+	Name  string                                // Used to identify the matcher
+	Regex *regexp.Regexp                        // Pattern tested against EqLog.Msg
+	Build func(log EqLog, match []string) Event // Converts submatches to an event, returning nil skips to the next matcher
+}
+
+// EventParser holds a registry of matchers and converts EqLog values to events
+type EventParser struct {
+	matchers []EventMatcher
+}
+
+// NewEventParser returns a parser with all built in matchers registered
+func NewEventParser() *EventParser {
+	p := &EventParser{}
+	p.matchers = append(p.matchers, defaultEventMatchers...)
+	return p
+}
+
+// Register adds a matcher to the parser, matchers registered later take precedence over earlier ones
+func (p *EventParser) Register(name, pattern string, build func(log EqLog, match []string) Event) error {
+	if build == nil {
+		return errors.New("matcher " + name + " needs a build function")
+	}
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	p.matchers = append([]EventMatcher{{Name: name, Regex: r, Build: build}}, p.matchers...)
+	return nil
+}
+
+// Parse returns the event for the first matcher that accepts the log, false if nothing matched
+func (p *EventParser) Parse(log EqLog) (Event, bool) {
+	for _, m := range p.matchers {
+		match := m.Regex.FindStringSubmatch(log.Msg)
+		if match == nil {
+			continue
+		}
+		if e := m.Build(log, match); e != nil {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// Stream parses every log from in and sends matched events to out until in is closed
+func (p *EventParser) Stream(in <-chan EqLog, out chan<- Event) {
+	for log := range in {
+		if e, ok := p.Parse(log); ok {
+			out <- e
+		}
+	}
+}
+
+var defaultParser = NewEventParser()
+
+// DefaultEventParser returns the parser shared by ParseEvent and every tracker without a parser of its own.
+// Matchers registered on it reach all of them, register them before any logs are read.
+func DefaultEventParser() *EventParser {
+	return defaultParser
+}
+
+// ParseEvent parses a log with the built in matchers
+func ParseEvent(log EqLog) (Event, bool) {
+	return defaultParser.Parse(log)
+}
+
+const meleeVerbs = `hits?|slash(?:es)?|pierces?|crush(?:es)?|bash(?:es)?|kicks?|punch(?:es)?|bites?|claws?|backstabs?|strikes?|slices?|stings?|mauls?|gores?|smash(?:es)?|rends?|shoots?|sweeps?|frenz(?:y|ies) on`
+
+var defaultEventMatchers = []EventMatcher{
+	{
+		Name:  "non-melee",
+		Regex: regexp.MustCompile(`^(.+?) was hit by non-melee for (\d+) points? of damage\.$`),
+		Build: func(log EqLog, m []string) Event {
+			return &SpellDamageEvent{EqLog: log, Defender: normalizeYou(m[1]), Damage: atoi(m[2])}
+		},
+	},
+	{
+		Name:  "melee hit",
+		Regex: regexp.MustCompile(`^(.+?) (` + meleeVerbs + `) (.+?) for (\d+) points? of damage\.(?: \((.+)\))?$`),
+		Build: func(log EqLog, m []string) Event {
+			return &MeleeHitEvent{EqLog: log, Attacker: normalizeYou(m[1]), Verb: m[2], Defender: normalizeYou(m[3]), Damage: atoi(m[4]), Modifiers: m[5]}
+		},
+	},
+	{
+		Name:  "spell damage",
+		Regex: regexp.MustCompile(`^(.+?) hit (.+?) for (\d+) points? of (\w+) damage by (.+?)\.(?: \((.+)\))?$`),
+		Build: func(log EqLog, m []string) Event {
+			return &SpellDamageEvent{EqLog: log, Attacker: normalizeYou(m[1]), Defender: normalizeYou(m[2]), Damage: atoi(m[3]), DamageType: m[4], Spell: m[5], Modifiers: m[6]}
+		},
+	},
+	{
+		Name:  "own dot",
+		Regex: regexp.MustCompile(`^(.+?) has taken (\d+) damage from your (.+?)\.(?: \((.+)\))?$`),
+		Build: func(log EqLog, m []string) Event {
+			return &DotDamageEvent{EqLog: log, Attacker: "You", Defender: normalizeYou(m[1]), Damage: atoi(m[2]), Spell: m[3], Modifiers: m[4]}
+		},
+	},
+	{
+		Name:  "dot",
+		Regex: regexp.MustCompile(`^(.+?) ha(?:s|ve) taken (\d+) damage from (.+?) by (.+?)\.(?: \((.+)\))?$`),
+		Build: func(log EqLog, m []string) Event {
+			return &DotDamageEvent{EqLog: log, Attacker: normalizeYou(m[3]), Defender: normalizeYou(m[1]), Damage: atoi(m[2]), Spell: m[4], Modifiers: m[5]}
+		},
+	},
+	{
+		Name:  "heal",
+		Regex: regexp.MustCompile(`^(.+?) (?:healed|has healed) (.+?)( over time)? for (\d+)(?: \((\d+)\))? (?:hit )?points?(?: by (.+?))?\.(?: \((.+)\))?$`),
+		Build: func(log EqLog, m []string) Event {
+			target := normalizeYou(m[2])
+			switch target {
+			case "himself", "herself", "itself":
+				target = normalizeYou(m[1])
+			}
+			return &HealEvent{EqLog: log, Healer: normalizeYou(m[1]), Target: target, OverTime: m[3] != "", Amount: atoi(m[4]), Full: atoi(m[5]), Spell: m[6], Modifiers: m[7]}
+		},
+	},
+	{
+		Name:  "healed",
+		Regex: regexp.MustCompile(`^You have been healed for (\d+) points?\.$`),
+		Build: func(log EqLog, m []string) Event {
+			return &HealEvent{EqLog: log, Target: "You", Amount: atoi(m[1])}
+		},
+	},
+	{
+		Name:  "loot",
+		Regex: regexp.MustCompile(`^--(\w+) ha(?:s|ve) looted (?:(an?|\d+) )?(.+?)(?: from (.+?))?\.--$`),
+		Build: func(log EqLog, m []string) Event {
+			count := 1
+			if n, err := strconv.Atoi(m[2]); err == nil {
+				count = n
+			}
+			return &LootEvent{EqLog: log, Looter: m[1], Item: m[3], Count: count, Corpse: strings.TrimSuffix(m[4], "'s corpse")}
+		},
+	},
+	{
+		Name:  "master looter",
+		Regex: regexp.MustCompile(`^-*(\w+) (?:has|have) been given (?:(an?|\d+) )?(.+?) by (?:the master looter|the loot master|(\w+))\.-*$`),
+		Build: func(log EqLog, m []string) Event {
+			count := 1
+			if n, err := strconv.Atoi(m[2]); err == nil {
+				count = n
+			}
+			giver := m[4]
+			if giver == "" {
+				giver = "master looter"
+			}
+			return &LootEvent{EqLog: log, Looter: m[1], Item: m[3], Count: count, Giver: giver}
+		},
+	},
+	{
+		Name:  "zone",
+		Regex: regexp.MustCompile(`^You have entered (.+?)\.$`),
+		Build: func(log EqLog, m []string) Event {
+			if strings.HasPrefix(m[1], "an area where") { // levitation and other zone area warnings
+				return nil
+			}
+			return &ZoneEvent{EqLog: log, Zone: m[1]}
+		},
+	},
+	{
+		Name:  "level",
+		Regex: regexp.MustCompile(`^You have (gained|lost) a level! Welcome to level (\d+)[!.]$`),
+		Build: func(log EqLog, m []string) Event {
+			return &LevelEvent{EqLog: log, Level: atoi(m[2]), Lost: m[1] == "lost"}
+		},
+	},
+	{
+		Name:  "experience",
+		Regex: regexp.MustCompile(`^You gain(?:ed)? (?:(party|group|raid) )?experience!*(?:\s*\((\d+(?:\.\d+)?)%\))?$`),
+		Build: func(log EqLog, m []string) Event {
+			e := &ExperienceEvent{EqLog: log, Share: m[1]}
+			if m[1] == "group" {
+				e.Share = "party"
+			}
+			e.Percent, _ = strconv.ParseFloat(m[2], 64)
+			return e
+		},
+	},
+	{
+		Name:  "aa point",
+		Regex: regexp.MustCompile(`^You have gained (an|\d+) ability point(?:s|\(s\))?!(?:\s+You now have (\d+) ability point(?:s|\(s\))?\.)?$`),
+		Build: func(log EqLog, m []string) Event {
+			e := &AAPointEvent{EqLog: log, Points: 1, Total: atoi(m[2])}
+			if m[1] != "an" {
+				e.Points = atoi(m[1])
+			}
+			return e
+		},
+	},
+	{
+		Name:  "slain by",
+		Regex: regexp.MustCompile(`^(.+?) ha(?:s|ve) been slain by (.+?)!$`),
+		Build: func(log EqLog, m []string) Event {
+			return &DeathEvent{EqLog: log, Victim: normalizeYou(m[1]), Killer: normalizeYou(m[2])}
+		},
+	},
+	{
+		Name:  "you slay",
+		Regex: regexp.MustCompile(`^You have slain (.+?)!$`),
+		Build: func(log EqLog, m []string) Event {
+			return &DeathEvent{EqLog: log, Victim: m[1], Killer: "You"}
+		},
+	},
+	{
+		Name:  "died",
+		Regex: regexp.MustCompile(`^(.+?) died\.$`),
+		Build: func(log EqLog, m []string) Event {
+			return &DeathEvent{EqLog: log, Victim: normalizeYou(m[1])}
+		},
+	},
+	{
+		Name:  "tell",
+		Regex: regexp.MustCompile(`^(\w+) tells you, '(.*)'$`),
+		Build: func(log EqLog, m []string) Event {
+			return &TellEvent{EqLog: log, From: m[1], To: "You", Text: m[2]}
+		},
+	},
+	{
+		Name:  "told",
+		Regex: regexp.MustCompile(`^You told (\w+), '(.*)'$`),
+		Build: func(log EqLog, m []string) Event {
+			return &TellEvent{EqLog: log, From: "You", To: m[1], Text: m[2], Outgoing: true}
+		},
+	},
+	{
+		Name:  "who entry",
+		Regex: regexp.MustCompile(`^\s*(?:(?:AFK|LFG|<LINKDEAD>|\*GM\*)\s*)*\[(?:ANONYMOUS|ROLEPLAY|\d+ [^\]]+)\] \w+`),
+		Build: func(log EqLog, m []string) Event {
+			return parseWhoEntry(log)
+		},
+	},
+	{
+		Name:  "die rolled",
+		Regex: regexp.MustCompile(`^\*\*A Magic Die is rolled by (\w+)\.$`),
+		Build: func(log EqLog, m []string) Event {
+			return &DieRolledEvent{EqLog: log, Roller: m[1]}
+		},
+	},
+	{
+		Name:  "roll result",
+		Regex: regexp.MustCompile(`^\*\*It could have been any number from (\d+) to (\d+), but this time it turned up a (\d+)\.$`),
+		Build: func(log EqLog, m []string) Event {
+			return &RollResultEvent{EqLog: log, Min: atoi(m[1]), Max: atoi(m[2]), Result: atoi(m[3])}
+		},
+	},
+}
+
+// normalizeYou maps the log owner's various spellings to You
+func normalizeYou(name string) string {
+	switch name {
+	case "YOU", "you", "yourself", "Yourself":
+		return "You"
+	}
+	return name
+}
+
+func isCritical(modifiers string) bool {
+	return strings.Contains(modifiers, "Critical") || strings.Contains(modifiers, "Crippling Blow")
+}
+
+func atoi(s string) int {
+	i, _ := strconv.Atoi(s)
+	return i
+}
@@ -0,0 +1,136 @@
+package everquest
+
+import (
+	"testing"
+)
+
+func TestParseEvent(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want EventType
+	}{
+		{"Xibab slashes a cave bear for 45 points of damage.", EventMeleeHit},
+		{"A cave bear bites YOU for 30 points of damage.", EventMeleeHit},
+		{"a cave bear was hit by non-melee for 200 points of damage.", EventSpellDamage},
+		{"You hit a cave bear for 1200 points of fire damage by Ice Comet. (Critical)", EventSpellDamage},
+		{"a cave bear has taken 300 damage from your Splurt.", EventDotDamage},
+		{"Xibab healed you for 1200 (1500) hit points by Complete Heal.", EventHeal},
+		{"--Xibab has looted a Shawl of Perception from Lord Vyemm's corpse.--", EventLoot},
+		{"You have entered The Plane of Knowledge.", EventZone},
+		{"You have gained a level! Welcome to level 60!", EventLevel},
+		{"You gain party experience!!", EventExperience},
+		{"You have gained an ability point!  You now have 5 ability points.", EventAAPoint},
+		{"Xibab has been slain by Lord Vyemm!", EventDeath},
+		{"Zortax tells you, 'hello'", EventTell},
+		{"[60 Grave Lord] Xibab (Iksar) <Guild> ZONE: potimea", EventWhoEntry},
+		{"**A Magic Die is rolled by Xibab.", EventDieRolled},
+		{"**It could have been any number from 0 to 100, but this time it turned up a 42.", EventRollResult},
+	}
+	for _, test := range tests {
+		e, ok := ParseEvent(EqLog{Msg: test.msg})
+		if !ok {
+			t.Fatalf("Error parsing event from %s", test.msg)
+		}
+		if e.Type() != test.want {
+			t.Fatalf("Error parsing event from %s: got %s want %s", test.msg, e.Type(), test.want)
+		}
+	}
+	if _, ok := ParseEvent(EqLog{Msg: "You have entered an area where levitation effects do not function."}); ok {
+		t.Fatalf("Error levitation warning parsed as zone change")
+	}
+}
+
+func TestParseEventFields(t *testing.T) {
+	e, _ := ParseEvent(EqLog{Msg: "You hit a cave bear for 1200 points of fire damage by Ice Comet. (Critical)"})
+	spell := e.(*SpellDamageEvent)
+	if spell.Attacker != "You" || spell.Defender != "a cave bear" || spell.Damage != 1200 || spell.Spell != "Ice Comet" || !spell.Critical() {
+		t.Fatalf("Error parsing spell damage fields: %+v", spell)
+	}
+	e, _ = ParseEvent(EqLog{Msg: "--You have looted 3 Bone Chips from a skeleton's corpse.--"})
+	loot := e.(*LootEvent)
+	if loot.Looter != "You" || loot.Count != 3 || loot.Item != "Bone Chips" || loot.Corpse != "a skeleton" {
+		t.Fatalf("Error parsing loot fields: %+v", loot)
+	}
+}
+
+func TestFormatEventMessage(t *testing.T) {
+	msgs := []string{
+		"Xibab slashes a cave bear for 45 points of damage.",
+		"A cave bear bites YOU for 30 points of damage. (Riposte)",
+		"a cave bear was hit by non-melee for 200 points of damage.",
+		"You hit a cave bear for 1200 points of fire damage by Ice Comet. (Critical)",
+		"a cave bear has taken 300 damage from your Splurt.",
+		"a cave bear has taken 120 damage from Xibab by Splurt.",
+		"Xibab healed you for 1200 (1500) hit points by Complete Heal.",
+		"--Xibab has looted a Shawl of Perception from Lord Vyemm's corpse.--",
+		"--You have looted 3 Bone Chips from a skeleton's corpse.--",
+		"--Xibab has been given an Ancient Scroll by the master looter.--",
+		"You have entered The Plane of Knowledge.",
+		"You have gained a level! Welcome to level 60!",
+		"You gain party experience!!",
+		"You have gained an ability point!  You now have 5 ability points.",
+		"Xibab has been slain by Lord Vyemm!",
+		"You have slain a cave bear!",
+		"Zortax tells you, 'hello'",
+		"You told Zortax, 'hi'",
+		"AFK [60 Grave Lord] Xibab (Iksar) <Guild> ZONE: potimea",
+		"**A Magic Die is rolled by Xibab.",
+		"**It could have been any number from 0 to 100, but this time it turned up a 42.",
+	}
+	for _, msg := range msgs {
+		e, ok := ParseEvent(EqLog{Msg: msg})
+		if !ok {
+			t.Fatalf("Error parsing event from %s", msg)
+		}
+		got, err := FormatEventMessage(e)
+		if err != nil {
+			t.Fatalf("Error formatting %s: %s", msg, err)
+		}
+		if got != msg {
+			t.Fatalf("Error formatting event, got %s want %s", got, msg)
+		}
+	}
+}
+
+func TestRegisterEventMatcher(t *testing.T) {
+	p := NewEventParser()
+	err := p.Register("custom zone", `^You have entered (.+)\.$`, func(log EqLog, m []string) Event {
+		return &ZoneEvent{EqLog: log, Zone: "custom " + m[1]}
+	})
+	if err != nil {
+		t.Fatalf("Error registering matcher: %v", err)
+	}
+	e, _ := p.Parse(EqLog{Msg: "You have entered Crushbone."})
+	if e.(*ZoneEvent).Zone != "custom Crushbone" {
+		t.Fatalf("Error registered matcher did not take precedence")
+	}
+}
+
+func TestEventDispatcher(t *testing.T) {
+	d := NewEventDispatcher()
+	d.Parser = NewEventParser()
+	var parsed int
+	d.Parser.Register("counted heal", `^(\w+) healed (\w+) for (\d+) hit points by (.+)\.$`, func(log EqLog, m []string) Event {
+		parsed++
+		return nil // fall through to the built in heal matcher
+	})
+	heals := NewHealTracker("Mortimus", nil)
+	heals.Parser = d.Parser
+	encounters := NewEncounterTracker("Mortimus")
+	d.HandleLog(encounters.Observe)
+	d.Handle(heals.AddEvent)
+	var events int
+	d.Handle(func(Event) { events++ })
+
+	d.Add(EqLog{Msg: "Kaijin tells the raid, 'heals on MT'"})
+	d.Add(EqLog{Msg: "Kaijin healed Mortimus for 1200 hit points by Complete Heal."})
+	if parsed != 1 || events != 1 {
+		t.Fatalf("Error dispatching, parsed %d times for %d events", parsed, events)
+	}
+	if heals := heals.Heals(); len(heals) != 1 || heals[0].Healer != "Kaijin" {
+		t.Fatalf("Error handing event to tracker: %+v", heals)
+	}
+	if !encounters.Friendly("Kaijin") {
+		t.Fatalf("Error handing raid chat to log handlers")
+	}
+}
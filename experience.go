@@ -0,0 +1,191 @@
+package everquest
+
+import (
+	"errors"
+	"time"
+)
+
+// MinExperienceWindow is the shortest session rates are worked out for, a kill or two on their own say nothing about an hour
+const MinExperienceWindow = 5 * time.Minute
+
+var (
+	// ErrNotEnoughExperience is returned for estimates from a session shorter than MinExperienceWindow or without the gains needed
+	ErrNotEnoughExperience = errors.New("not enough experience gained yet to work out a rate")
+	// ErrNoExperiencePercent is returned for level estimates when the client doesn't show how much of a level each kill gave
+	ErrNoExperiencePercent = errors.New("the log doesn't show experience percentages")
+)
+
+// ExperienceSession totals the experience gained over one stretch of play in one zone
+type ExperienceSession struct {
+	Start        time.Time
+	End          time.Time
+	Zone         string  // Zone the session was played in, empty if the log never showed it
+	Kills        int     // Kills that gave experience
+	Percent      float64 // Percent of a level gained, only counted when the client shows it
+	PercentKills int     // Kills that showed the percent gained, 0 on clients that don't show it
+	AAPoints     int     // Alternate advancement points earned
+	Levels       int     // Levels gained less levels lost
+}
+
+// Duration returns how long the session lasted, from the first gain to the last
+func (s *ExperienceSession) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// HasRates returns true once the session is long enough to work out rates, see MinExperienceWindow
+func (s *ExperienceSession) HasRates() bool {
+	return s.Duration() >= MinExperienceWindow
+}
+
+// KillsPerHour returns experience giving kills per hour, 0 until the session HasRates
+func (s *ExperienceSession) KillsPerHour() float64 {
+	if !s.HasRates() {
+		return 0
+	}
+	return float64(s.Kills) / s.Duration().Hours()
+}
+
+// XPPerHour returns the percent of a level gained per hour.
+// It returns ErrNoExperiencePercent if the client doesn't show percentages and ErrNotEnoughExperience until the session HasRates.
+func (s *ExperienceSession) XPPerHour() (float64, error) {
+	if s.Kills > 0 && s.PercentKills == 0 {
+		return 0, ErrNoExperiencePercent
+	}
+	if !s.HasRates() {
+		return 0, ErrNotEnoughExperience
+	}
+	return s.Percent / s.Duration().Hours(), nil
+}
+
+// AAPerHour returns alternate advancement points earned per hour, 0 until the session HasRates
+func (s *ExperienceSession) AAPerHour() float64 {
+	if !s.HasRates() {
+		return 0
+	}
+	return float64(s.AAPoints) / s.Duration().Hours()
+}
+
+// TimeToLevel estimates how long until the next level from progress, the percent already gained into the current level.
+// The errors are those of XPPerHour, or ErrNotEnoughExperience if no experience was gained.
+func (s *ExperienceSession) TimeToLevel(progress float64) (time.Duration, error) {
+	rate, err := s.XPPerHour()
+	if err != nil {
+		return 0, err
+	}
+	if rate <= 0 {
+		return 0, ErrNotEnoughExperience
+	}
+	return time.Duration((100 - progress) / rate * float64(time.Hour)), nil
+}
+
+// TimeToAA estimates how long until the next alternate advancement point, ErrNotEnoughExperience until the session HasRates and has earned one
+func (s *ExperienceSession) TimeToAA() (time.Duration, error) {
+	rate := s.AAPerHour()
+	if rate <= 0 {
+		return 0, ErrNotEnoughExperience
+	}
+	return time.Duration(float64(time.Hour) / rate), nil
+}
+
+// ExperienceTracker splits a log into experience sessions, a new session starts after a long break or a zone change
+type ExperienceTracker struct {
+	LogOwner
+	SessionGap time.Duration // Break between gains that starts a new session, defaults to 30 minutes
+	Progress   float64       // Percent into the current level, counted from gains and reset on level up, set it if it is known
+
+	zone     string
+	current  *ExperienceSession
+	sessions []*ExperienceSession
+}
+
+// NewExperienceTracker creates a tracker for the log of character
+func NewExperienceTracker(character string) *ExperienceTracker {
+	return &ExperienceTracker{
+		LogOwner:   LogOwner{Character: character},
+		SessionGap: 30 * time.Minute,
+	}
+}
+
+// Add parses a log and records it if it is experience, a level change or a zone change
+func (t *ExperienceTracker) Add(log EqLog) {
+	if e, ok := t.parse(log); ok {
+		t.AddEvent(e)
+	}
+}
+
+// AddEvent records an already parsed event, times come from the log so historical logs give the same rates as live ones
+func (t *ExperienceTracker) AddEvent(e Event) {
+	switch ev := e.(type) {
+	case *ZoneEvent:
+		t.zone = ev.Zone
+		if t.current != nil && t.current.Zone != ev.Zone {
+			t.finish()
+		}
+	case *ExperienceEvent:
+		s := t.session(ev.T)
+		s.Kills++
+		if ev.Percent > 0 {
+			s.PercentKills++
+		}
+		s.Percent += ev.Percent
+		t.Progress += ev.Percent
+	case *AAPointEvent:
+		t.session(ev.T).AAPoints += ev.Points
+	case *LevelEvent:
+		s := t.session(ev.T)
+		if ev.Lost {
+			s.Levels--
+		} else {
+			s.Levels++
+		}
+		t.Progress = 0
+	}
+}
+
+// Current returns the session in progress, nil if there isn't one
+func (t *ExperienceTracker) Current() *ExperienceSession {
+	return t.current
+}
+
+// Sessions returns every session in order, including the one in progress
+func (t *ExperienceTracker) Sessions() []ExperienceSession {
+	var sessions []ExperienceSession
+	for _, s := range t.sessions {
+		sessions = append(sessions, *s)
+	}
+	if t.current != nil {
+		sessions = append(sessions, *t.current)
+	}
+	return sessions
+}
+
+// TimeToLevel estimates how long until the next level at the current session's rate, see ExperienceSession.TimeToLevel
+func (t *ExperienceTracker) TimeToLevel() (time.Duration, error) {
+	if t.current == nil {
+		return 0, ErrNotEnoughExperience
+	}
+	return t.current.TimeToLevel(t.Progress)
+}
+
+// session returns the session an event at time belongs to, starting a new one after a long break
+func (t *ExperienceTracker) session(at time.Time) *ExperienceSession {
+	gap := t.SessionGap
+	if gap <= 0 {
+		gap = 30 * time.Minute
+	}
+	if t.current != nil && at.Sub(t.current.End) > gap {
+		t.finish()
+	}
+	if t.current == nil {
+		t.current = &ExperienceSession{Start: at, Zone: t.zone}
+	}
+	if at.After(t.current.End) {
+		t.current.End = at
+	}
+	return t.current
+}
+
+func (t *ExperienceTracker) finish() {
+	t.sessions = append(t.sessions, t.current)
+	t.current = nil
+}
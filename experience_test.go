@@ -0,0 +1,73 @@
+package everquest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExperienceTracker(t *testing.T) {
+	start := time.Date(2021, time.January, 2, 20, 0, 0, 0, time.Local)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	tracker := NewExperienceTracker("Mortimus")
+	tracker.Add(EqLog{T: at(0), Msg: "You have entered The Overthere."})
+	tracker.Add(EqLog{T: at(0), Msg: "You gain party experience!! (2.5%)"})
+	if _, err := tracker.TimeToLevel(); err != ErrNotEnoughExperience {
+		t.Fatalf("Error estimating from a single kill: %v", err)
+	}
+	if rate := tracker.Current().KillsPerHour(); rate != 0 {
+		t.Fatalf("Error working out kill rate from a single kill: %f", rate)
+	}
+
+	tracker.Add(EqLog{T: at(10), Msg: "You gain party experience!! (2.5%)"})
+	tracker.Add(EqLog{T: at(20), Msg: "You gain party experience!! (5%)"})
+	tracker.Add(EqLog{T: at(30), Msg: "You have gained an ability point! You now have 5 ability points."})
+	s := tracker.Current()
+	if s.Zone != "The Overthere" || s.Kills != 3 || s.Percent != 10 || s.AAPoints != 1 {
+		t.Fatalf("Error totalling session: %+v", s)
+	}
+	if s.KillsPerHour() != 6 || s.AAPerHour() != 2 {
+		t.Fatalf("Error working out rates: kills %f aa %f", s.KillsPerHour(), s.AAPerHour())
+	}
+	if rate, err := s.XPPerHour(); err != nil || rate != 20 {
+		t.Fatalf("Error working out experience rate: %f %v", rate, err)
+	}
+	tracker.Progress = 40
+	if d, err := tracker.TimeToLevel(); err != nil || d != 3*time.Hour {
+		t.Fatalf("Error estimating time to level: %s %v", d, err)
+	}
+	if d, err := s.TimeToAA(); err != nil || d != 30*time.Minute {
+		t.Fatalf("Error estimating time to aa: %s %v", d, err)
+	}
+
+	tracker.Add(EqLog{T: at(31), Msg: "You have gained a level! Welcome to level 52!"})
+	if tracker.Progress != 0 || tracker.Current().Levels != 1 {
+		t.Fatalf("Error resetting progress on level up: %f", tracker.Progress)
+	}
+	tracker.Add(EqLog{T: at(32), Msg: "You have entered Skyfire Mountains."})
+	tracker.Add(EqLog{T: at(35), Msg: "You gain experience!! (1%)"})
+	tracker.Add(EqLog{T: at(120), Msg: "You gain experience!! (1%)"})
+	sessions := tracker.Sessions()
+	if len(sessions) != 3 || sessions[0].Zone != "The Overthere" || sessions[1].Zone != "Skyfire Mountains" || sessions[1].Kills != 1 || sessions[2].Kills != 1 {
+		t.Fatalf("Error splitting sessions on zone changes and breaks: %+v", sessions)
+	}
+}
+
+func TestExperienceWithoutPercent(t *testing.T) {
+	start := time.Date(2021, time.January, 2, 20, 0, 0, 0, time.Local)
+	tracker := NewExperienceTracker("Mortimus")
+	tracker.Add(EqLog{T: start, Msg: "You gain experience!!"})
+	tracker.Add(EqLog{T: start.Add(20 * time.Minute), Msg: "You gain experience!!"})
+	s := tracker.Current()
+	if s.KillsPerHour() != 6 {
+		t.Fatalf("Error working out kill rate without percentages: %f", s.KillsPerHour())
+	}
+	if _, err := s.XPPerHour(); err != ErrNoExperiencePercent {
+		t.Fatalf("Error reporting missing percentages: %v", err)
+	}
+	if _, err := tracker.TimeToLevel(); err != ErrNoExperiencePercent {
+		t.Fatalf("Error reporting missing percentages for time to level: %v", err)
+	}
+	if _, err := s.TimeToAA(); err != ErrNotEnoughExperience {
+		t.Fatalf("Error estimating time to aa with none earned: %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package everquest
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// GinaDisplayCallback is the callback name imported GINA display text is sent to, register it on the engine before adding the rules
+const GinaDisplayCallback = "display"
+
+// GinaImport holds the rules converted from a GINA trigger package along with anything that could not be converted
+type GinaImport struct {
+	Rules    []TriggerRule
+	Warnings []string
+}
+
+// AddTo adds every imported rule to the engine, rules the engine rejects are added to Warnings
+func (g *GinaImport) AddTo(engine *TriggerEngine) {
+	for _, rule := range g.Rules {
+		if err := engine.AddRule(rule); err != nil {
+			g.Warnings = append(g.Warnings, err.Error())
+		}
+	}
+}
+
+// ImportGinaPackage reads a GINA .gtp share file (zipped xml) and converts its triggers to rules
+func ImportGinaPackage(path string) (*GinaImport, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	result := &GinaImport{}
+	found := false
+	for _, f := range archive.File {
+		if !strings.HasSuffix(strings.ToLower(f.Name), ".xml") {
+			continue
+		}
+		found = true
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		imported, err := ImportGinaXML(r)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		result.Rules = append(result.Rules, imported.Rules...)
+		result.Warnings = append(result.Warnings, imported.Warnings...)
+	}
+	if !found {
+		return nil, errors.New("no trigger xml found in gina package: " + path)
+	}
+	return result, nil
+}
+
+// ImportGinaXML converts the ShareData.xml found inside a GINA package
+func ImportGinaXML(r io.Reader) (*GinaImport, error) {
+	var data ginaSharedData
+	if err := xml.NewDecoder(r).Decode(&data); err != nil {
+		return nil, err
+	}
+	result := &GinaImport{}
+	for _, group := range data.TriggerGroups {
+		result.importGroup(group, "", true)
+	}
+	return result, nil
+}
+
+type ginaSharedData struct {
+	TriggerGroups []ginaTriggerGroup `xml:"TriggerGroups>TriggerGroup"`
+}
+
+type ginaTriggerGroup struct {
+	Name            string             `xml:"Name"`
+	EnableByDefault string             `xml:"EnableByDefault"`
+	TriggerGroups   []ginaTriggerGroup `xml:"TriggerGroups>TriggerGroup"`
+	Triggers        []ginaTrigger      `xml:"Triggers>Trigger"`
+}
+
+type ginaTrigger struct {
+	Name                     string           `xml:"Name"`
+	TriggerText              string           `xml:"TriggerText"`
+	EnableRegex              string           `xml:"EnableRegex"`
+	UseText                  string           `xml:"UseText"`
+	DisplayText              string           `xml:"DisplayText"`
+	CopyToClipboard          string           `xml:"CopyToClipboard"`
+	UseTextToVoice           string           `xml:"UseTextToVoice"`
+	PlayMediaFile            string           `xml:"PlayMediaFile"`
+	TimerType                string           `xml:"TimerType"`
+	TimerName                string           `xml:"TimerName"`
+	TimerMillisecondDuration int              `xml:"TimerMillisecondDuration"`
+	TimerDuration            int              `xml:"TimerDuration"` // seconds, older packages only have this
+	TimerStartBehavior       string           `xml:"TimerStartBehavior"`
+	TimerEndingTime          int              `xml:"TimerEndingTime"` // seconds before the end
+	UseTimerEnding           string           `xml:"UseTimerEnding"`
+	UseTimerEnded            string           `xml:"UseTimerEnded"`
+	TimerEndingTrigger       ginaSubTrigger   `xml:"TimerEndingTrigger"`
+	TimerEndedTrigger        ginaSubTrigger   `xml:"TimerEndedTrigger"`
+	UseCounterResetTimer     string           `xml:"UseCounterResetTimer"`
+	Category                 string           `xml:"Category"`
+	TimerEarlyEnders         []ginaEarlyEnder `xml:"TimerEarlyEnders>EarlyEnder"`
+}
+
+type ginaSubTrigger struct {
+	UseText        string `xml:"UseText"`
+	DisplayText    string `xml:"DisplayText"`
+	UseTextToVoice string `xml:"UseTextToVoice"`
+	PlayMediaFile  string `xml:"PlayMediaFile"`
+}
+
+type ginaEarlyEnder struct {
+	EarlyEndText string `xml:"EarlyEndText"`
+}
+
+func (g *GinaImport) importGroup(group ginaTriggerGroup, parent string, enabled bool) {
+	path := group.Name
+	if parent != "" {
+		path = parent + "/" + group.Name
+	}
+	if group.EnableByDefault != "" && !ginaBool(group.EnableByDefault) {
+		enabled = false
+	}
+	for _, trigger := range group.Triggers {
+		rule, err := g.convertTrigger(trigger, path)
+		if err != nil {
+			g.warn(path, trigger.Name, err.Error()+", skipped")
+			continue
+		}
+		rule.Disabled = !enabled
+		g.Rules = append(g.Rules, rule)
+	}
+	for _, child := range group.TriggerGroups {
+		g.importGroup(child, path, enabled)
+	}
+}
+
+func (g *GinaImport) convertTrigger(t ginaTrigger, group string) (TriggerRule, error) {
+	rule := TriggerRule{
+		Name:     group + "/" + t.Name,
+		Group:    group,
+		Category: t.Category,
+	}
+	var err error
+	if ginaBool(t.EnableRegex) {
+		rule.Pattern, err = ginaRegex(t.TriggerText)
+	} else {
+		rule.Pattern = ginaText(t.TriggerText)
+	}
+	if err != nil {
+		return rule, err
+	}
+	if strings.Contains(t.TriggerText, "{N>") || strings.Contains(t.TriggerText, "{N<") || strings.Contains(t.TriggerText, "{N=") {
+		g.warn(group, t.Name, "numeric comparisons are not supported, matching any number")
+	}
+
+	rule.Actions = append(rule.Actions, g.subActions(group, t.Name, ginaSubTrigger{
+		UseText:        t.UseText,
+		DisplayText:    t.DisplayText,
+		UseTextToVoice: t.UseTextToVoice,
+		PlayMediaFile:  t.PlayMediaFile,
+	})...)
+	if ginaBool(t.CopyToClipboard) {
+		g.warn(group, t.Name, "copy to clipboard is not supported")
+	}
+	if ginaBool(t.UseCounterResetTimer) {
+		g.warn(group, t.Name, "counters are not supported")
+	}
+
+	switch t.TimerType {
+	case "", "NoTimer":
+	case "Timer", "RepeatingTimer":
+		duration := time.Duration(t.TimerMillisecondDuration) * time.Millisecond
+		if duration == 0 {
+			duration = time.Duration(t.TimerDuration) * time.Second
+		}
+		if duration <= 0 {
+			g.warn(group, t.Name, "timer has no duration, timer skipped")
+			break
+		}
+		if t.TimerType == "RepeatingTimer" {
+			g.warn(group, t.Name, "repeating timers are imported as single timers")
+		}
+		if t.TimerStartBehavior != "" && t.TimerStartBehavior != "RestartTimer" {
+			g.warn(group, t.Name, "timer start behavior "+t.TimerStartBehavior+" is not supported, timers always restart")
+		}
+		if len(t.TimerEarlyEnders) > 0 {
+			g.warn(group, t.Name, "timer early enders are not supported")
+		}
+		name := t.TimerName
+		if name == "" {
+			name = t.Name
+		}
+		timer := ActionConfig{
+			Type:     "timer",
+			Name:     ginaDisplay(name),
+			Duration: ConfigDuration(duration),
+		}
+		if ginaBool(t.UseTimerEnding) {
+			timer.Warning = ConfigDuration(time.Duration(t.TimerEndingTime) * time.Second)
+			timer.OnWarn = g.subActions(group, t.Name+" (timer ending)", t.TimerEndingTrigger)
+		}
+		if ginaBool(t.UseTimerEnded) {
+			timer.OnEnd = g.subActions(group, t.Name+" (timer ended)", t.TimerEndedTrigger)
+		}
+		rule.Actions = append(rule.Actions, timer)
+	default:
+		g.warn(group, t.Name, "timer type "+t.TimerType+" is not supported, timer skipped")
+	}
+	return rule, nil
+}
+
+// subActions converts the text portion of a trigger, warning about audio
+func (g *GinaImport) subActions(group, name string, t ginaSubTrigger) []ActionConfig {
+	var actions []ActionConfig
+	if ginaBool(t.UseText) && t.DisplayText != "" {
+		actions = append(actions, ActionConfig{Type: "callback", Name: GinaDisplayCallback, Text: ginaDisplay(t.DisplayText)})
+	}
+	if ginaBool(t.UseTextToVoice) {
+		g.warn(group, name, "text to speech is not supported")
+	}
+	if ginaBool(t.PlayMediaFile) {
+		g.warn(group, name, "playing sound files is not supported")
+	}
+	return actions
+}
+
+func (g *GinaImport) warn(group, trigger, msg string) {
+	g.Warnings = append(g.Warnings, group+"/"+trigger+": "+msg)
+}
+
+var ginaTokenRegex = regexp.MustCompile(`\{(?:S\d*|N\d*(?:[<>=]+\d+)?|C)\}`)
+var ginaNumberName = regexp.MustCompile(`^N\d*`)
+
+// ginaText converts a plain GINA trigger into a regex, turning {S} and {N} into named captures
+func ginaText(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range ginaTokenRegex.FindAllStringIndex(text, -1) {
+		b.WriteString(regexp.QuoteMeta(text[last:loc[0]]))
+		b.WriteString(ginaToken(text[loc[0]:loc[1]]))
+		last = loc[1]
+	}
+	b.WriteString(regexp.QuoteMeta(text[last:]))
+	return b.String()
+}
+
+// ginaRegex converts a .NET style GINA regex into go syntax
+func ginaRegex(text string) (string, error) {
+	if strings.Contains(text, "(?<=") || strings.Contains(text, "(?<!") || strings.Contains(text, "(?=") || strings.Contains(text, "(?!") {
+		return "", errors.New("lookaround is not supported")
+	}
+	text = strings.ReplaceAll(text, "(?<", "(?P<")
+	text = ginaTokenRegex.ReplaceAllStringFunc(text, ginaToken)
+	if _, err := regexp.Compile(strings.ReplaceAll(text, "{C}", "")); err != nil {
+		return "", err
+	}
+	return text, nil
+}
+
+func ginaToken(token string) string {
+	switch {
+	case token == "{C}":
+		return token // filled in by the engine with its character
+	case strings.HasPrefix(token, "{S"):
+		return "(?P<" + token[1:len(token)-1] + ">.+)"
+	default:
+		return "(?P<" + ginaNumberName.FindString(token[1:]) + `>\d+)`
+	}
+}
+
+// ginaDisplay converts GINA display text tokens to ones TriggerMatch.Expand understands
+func ginaDisplay(text string) string {
+	return strings.ReplaceAll(text, "{c}", "{C}")
+}
+
+func ginaBool(s string) bool {
+	return strings.EqualFold(strings.TrimSpace(s), "true")
+}
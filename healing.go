@@ -0,0 +1,194 @@
+package everquest
+
+import (
+	"sort"
+	"time"
+)
+
+// RaidNightCutoff is the hour a raid night rolls over, events before it count towards the previous night
+const RaidNightCutoff = 6
+
+// RaidNight returns midnight of the raid night t belongs to, a 1am kill still counts as the night before
+func RaidNight(t time.Time) time.Time {
+	night := t.Add(-RaidNightCutoff * time.Hour)
+	return time.Date(night.Year(), night.Month(), night.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// HealRecord is a single heal attributed to healer, target and spell
+type HealRecord struct {
+	T        time.Time
+	Healer   string
+	Target   string
+	Spell    string
+	SpellID  int  // Spell id from the SpellDB, -1 if unknown
+	Amount   int  // Hit points actually restored
+	Overheal int  // Hit points wasted, only known when the log shows both numbers
+	OverTime bool // Heal over time tick
+	Critical bool
+}
+
+// HealerStats totals the healing one healer did
+type HealerStats struct {
+	Name     string
+	Total    int            // Hit points restored
+	Overheal int            // Hit points wasted
+	Heals    int            // Number of heals landed
+	HoTTicks int            // Number of heal over time ticks landed
+	Crits    int            // Number of critical heals
+	Targets  map[string]int // Healing done keyed by target
+	Spells   map[string]int // Healing done keyed by spell
+}
+
+// HealingReport totals healing over a period of time, like an encounter or a raid night
+type HealingReport struct {
+	Start   time.Time
+	End     time.Time
+	Healers map[string]*HealerStats
+}
+
+// Ranked returns every healer sorted by healing done, highest first
+func (r *HealingReport) Ranked() []HealerStats {
+	var ranked []HealerStats
+	for _, h := range r.Healers {
+		ranked = append(ranked, *h)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Total == ranked[j].Total {
+			return ranked[i].Name < ranked[j].Name
+		}
+		return ranked[i].Total > ranked[j].Total
+	})
+	return ranked
+}
+
+// Total returns all healing done
+func (r *HealingReport) Total() int {
+	var total int
+	for _, h := range r.Healers {
+		total += h.Total
+	}
+	return total
+}
+
+// HPS returns a healer's healing per second over the report
+func (r *HealingReport) HPS(name string) float64 {
+	h, ok := r.Healers[name]
+	if !ok {
+		return 0
+	}
+	d := r.End.Sub(r.Start)
+	if d < time.Second {
+		d = time.Second
+	}
+	return float64(h.Total) / d.Seconds()
+}
+
+func (r *HealingReport) add(heal HealRecord) {
+	h, ok := r.Healers[heal.Healer]
+	if !ok {
+		h = &HealerStats{Name: heal.Healer, Targets: make(map[string]int), Spells: make(map[string]int)}
+		r.Healers[heal.Healer] = h
+	}
+	h.Total += heal.Amount
+	h.Overheal += heal.Overheal
+	if heal.OverTime {
+		h.HoTTicks++
+	} else {
+		h.Heals++
+	}
+	if heal.Critical {
+		h.Crits++
+	}
+	h.Targets[heal.Target] += heal.Amount
+	h.Spells[heal.Spell] += heal.Amount
+}
+
+// HealTracker collects heals from a log stream
+type HealTracker struct {
+	LogOwner
+	Spells *SpellDB // Used to resolve spell ids, may be nil
+
+	heals []HealRecord
+}
+
+// NewHealTracker creates a tracker for the log of character, resolving spells against spells
+func NewHealTracker(character string, spells *SpellDB) *HealTracker {
+	return &HealTracker{
+		LogOwner: LogOwner{Character: character},
+		Spells:   spells,
+	}
+}
+
+// Add parses a log and records it if it is a heal
+func (t *HealTracker) Add(log EqLog) {
+	if e, ok := t.parse(log); ok {
+		t.AddEvent(e)
+	}
+}
+
+// AddEvent records an already parsed event, ignoring anything that isn't a heal
+func (t *HealTracker) AddEvent(e Event) {
+	heal, ok := e.(*HealEvent)
+	if !ok {
+		return
+	}
+	record := HealRecord{
+		T:        heal.T,
+		Healer:   t.resolveName(heal.Healer),
+		Target:   t.resolveName(heal.Target),
+		Spell:    heal.Spell,
+		SpellID:  -1,
+		Amount:   heal.Amount,
+		OverTime: heal.OverTime,
+		Critical: isCritical(heal.Modifiers),
+	}
+	if heal.Full > heal.Amount {
+		record.Overheal = heal.Full - heal.Amount
+	}
+	if t.Spells != nil && heal.Spell != "" {
+		if id, err := t.Spells.FindIDByName(heal.Spell); err == nil {
+			record.SpellID = id
+		}
+	}
+	t.heals = append(t.heals, record)
+}
+
+// Heals returns every recorded heal in order
+func (t *HealTracker) Heals() []HealRecord {
+	return t.heals
+}
+
+// Report totals the heals landed between start and end, inclusive
+func (t *HealTracker) Report(start, end time.Time) *HealingReport {
+	report := &HealingReport{Start: start, End: end, Healers: make(map[string]*HealerStats)}
+	for _, heal := range t.heals {
+		if heal.T.Before(start) || heal.T.After(end) {
+			continue
+		}
+		report.add(heal)
+	}
+	return report
+}
+
+// EncounterReport totals the heals landed during an encounter
+func (t *HealTracker) EncounterReport(e *Encounter) *HealingReport {
+	return t.Report(e.Start, e.End)
+}
+
+// NightlyReports totals heals per raid night, keyed by RaidNight
+func (t *HealTracker) NightlyReports() map[time.Time]*HealingReport {
+	reports := make(map[time.Time]*HealingReport)
+	for _, heal := range t.heals {
+		night := RaidNight(heal.T)
+		report, ok := reports[night]
+		if !ok {
+			report = &HealingReport{Start: heal.T, End: heal.T, Healers: make(map[string]*HealerStats)}
+			reports[night] = report
+		}
+		if heal.T.After(report.End) {
+			report.End = heal.T
+		}
+		report.add(heal)
+	}
+	return reports
+}
@@ -0,0 +1,84 @@
+package everquest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRaidNight(t *testing.T) {
+	night := time.Date(2021, time.January, 2, 0, 0, 0, 0, time.Local)
+	for _, at := range []time.Time{
+		time.Date(2021, time.January, 2, 20, 0, 0, 0, time.Local),
+		time.Date(2021, time.January, 2, 23, 59, 59, 0, time.Local),
+		time.Date(2021, time.January, 3, 1, 30, 0, 0, time.Local),
+		time.Date(2021, time.January, 3, 5, 59, 59, 0, time.Local),
+	} {
+		if got := RaidNight(at); !got.Equal(night) {
+			t.Fatalf("Error finding raid night of %s, got %s", at, got)
+		}
+	}
+	if got := RaidNight(time.Date(2021, time.January, 3, 6, 0, 0, 0, time.Local)); got.Equal(night) {
+		t.Fatalf("Error rolling raid night over at the cutoff, got %s", got)
+	}
+}
+
+func TestHealTracker(t *testing.T) {
+	db := &SpellDB{byID: make(map[int]Spell), byName: make(map[string]int)}
+	db.byID[13] = Spell{Id: 13, Name: "Complete Heal"}
+	db.byName["complete heal"] = 13
+	start := time.Date(2021, time.January, 2, 22, 0, 0, 0, time.Local)
+	lines := []struct {
+		at  time.Time
+		msg string
+	}{
+		{start, "Kaijin healed Mortimus for 1200 (4500) hit points by Complete Heal."},
+		{start.Add(10 * time.Second), "You healed Kaijin for 500 hit points by Superior Healing."},
+		{start.Add(20 * time.Second), "Kaijin healed You over time for 100 hit points by Celestial Elixir."},
+		{time.Date(2021, time.January, 3, 1, 30, 0, 0, time.Local), "Kaijin healed Mortimus for 2000 hit points by Complete Heal. (Critical)"},
+		{time.Date(2021, time.January, 3, 21, 0, 0, 0, time.Local), "You healed Kaijin for 300 hit points by Superior Healing."},
+	}
+	tracker := NewHealTracker("Voltha", db)
+	for _, line := range lines {
+		tracker.Add(EqLog{T: line.at, Msg: line.msg})
+	}
+
+	heals := tracker.Heals()
+	if len(heals) != 5 {
+		t.Fatalf("Error recording heals, got %d", len(heals))
+	}
+	if heals[0].Amount != 1200 || heals[0].Overheal != 3300 || heals[0].SpellID != 13 {
+		t.Fatalf("Error reading overheal and spell id: %+v", heals[0])
+	}
+	if heals[1].Healer != "Voltha" || heals[1].SpellID != -1 || heals[1].Overheal != 0 {
+		t.Fatalf("Error resolving log owner and unknown spell: %+v", heals[1])
+	}
+	if heals[2].Target != "Voltha" || !heals[2].OverTime {
+		t.Fatalf("Error reading heal over time: %+v", heals[2])
+	}
+
+	report := tracker.EncounterReport(&Encounter{Start: start, End: start.Add(20 * time.Second)})
+	ranked := report.Ranked()
+	if len(ranked) != 2 || ranked[0].Name != "Kaijin" || ranked[1].Name != "Voltha" {
+		t.Fatalf("Error ranking healers: %+v", ranked)
+	}
+	kaijin := ranked[0]
+	if kaijin.Total != 1300 || kaijin.Overheal != 3300 || kaijin.Heals != 1 || kaijin.HoTTicks != 1 || kaijin.Spells["Complete Heal"] != 1200 {
+		t.Fatalf("Error totalling healer: %+v", kaijin)
+	}
+	if report.Total() != 1800 || report.HPS("Kaijin") != 65 || report.HPS("Ryze") != 0 {
+		t.Fatalf("Error totalling report: total %d hps %f", report.Total(), report.HPS("Kaijin"))
+	}
+
+	nights := tracker.NightlyReports()
+	if len(nights) != 2 {
+		t.Fatalf("Error splitting raid nights, got %d", len(nights))
+	}
+	first := nights[time.Date(2021, time.January, 2, 0, 0, 0, 0, time.Local)]
+	if first == nil || first.Healers["Kaijin"].Total != 3300 || first.Healers["Kaijin"].Crits != 1 || !first.End.Equal(lines[3].at) {
+		t.Fatalf("Error counting a heal after midnight towards the night before: %+v", first)
+	}
+	second := nights[time.Date(2021, time.January, 3, 0, 0, 0, 0, time.Local)]
+	if second == nil || second.Total() != 300 {
+		t.Fatalf("Error reporting the second raid night: %+v", second)
+	}
+}
@@ -0,0 +1,579 @@
+package everquest
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// LogQuery describes a search against a LogIndex, empty fields match everything
+type LogQuery struct {
+	Start    time.Time // Only lines at or after Start
+	End      time.Time // Only lines at or before End
+	Channels []string  // Only lines in any of these channels
+	Sources  []string  // Only lines from any of these sources
+	Terms    []string  // Only lines containing every one of these words, case insensitive
+	Limit    int       // Maximum results to return, 0 for no limit
+}
+
+// LogIndex is an on disk index of eqlog files for fast historical searches.
+// Each file's lines are kept in time ordered segments under the Path directory, only the list of segments is held in memory.
+// Files are indexed incrementally, re-adding a file only reads what was appended since it was last indexed.
+type LogIndex struct {
+	Path     string         // Directory the index is saved in
+	Location *time.Location // Zone the indexed logs were written in, nil for local time
+
+	manifest indexManifest
+	dirty    map[string]*indexSegment // segments changed since the last Save, keyed by name
+	removed  []string                 // segment files to delete on the next Save
+}
+
+// indexManifest is the gob encoded list of indexed files and their segments
+type indexManifest struct {
+	Files []indexedFile
+	Next  uint32 // used to name the next segment
+}
+
+type indexedFile struct {
+	Path     string
+	Offset   int64     // bytes indexed so far
+	Head     uint32    // checksum of the first indexHeadSize bytes indexed, used to spot a replaced file
+	Last     time.Time // time of the last line indexed, carried over so a DST change between runs is read in order
+	Segments []segmentInfo
+}
+
+// segmentInfo describes a segment without loading it, letting searches skip segments outside their time range
+type segmentInfo struct {
+	Name  string
+	Count int
+	Start int64 // earliest entry, unix seconds
+	End   int64 // latest entry, unix seconds
+}
+
+// indexSegment is the gob encoded contents of one segment file, a run of lines from a single log
+type indexSegment struct {
+	Entries  []indexEntry        // sorted by time
+	Channels map[string][]uint32 // entry positions keyed by channel
+	Sources  map[string][]uint32 // entry positions keyed by lower case source
+	Terms    map[string][]uint32 // entry positions keyed by lower case word
+
+	unsorted bool // a line was added out of time order since the entries were last sorted
+}
+
+type indexEntry struct {
+	Offset int64
+	Length uint32
+	T      int64 // unix seconds
+}
+
+const (
+	indexHeadSize     = 4096
+	indexSegmentLines = 65536 // lines per segment before a new one is started
+	indexManifestName = "index.gob"
+)
+
+// OpenLogIndex loads the index stored in the directory at path, or starts an empty one if it doesn't exist yet
+func OpenLogIndex(path string) (*LogIndex, error) {
+	idx := &LogIndex{Path: path, dirty: make(map[string]*indexSegment)}
+	if err := readGob(filepath.Join(path, indexManifestName), &idx.manifest); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// Save writes the segments changed since the last save and the list of segments to Path, unchanged segments are left alone
+func (idx *LogIndex) Save() error {
+	if err := os.MkdirAll(idx.Path, 0755); err != nil {
+		return err
+	}
+	for name, seg := range idx.dirty {
+		seg.sort()
+		if err := writeGob(filepath.Join(idx.Path, name), seg); err != nil {
+			return err
+		}
+	}
+	if err := writeGob(filepath.Join(idx.Path, indexManifestName), &idx.manifest); err != nil {
+		return err
+	}
+	idx.dirty = make(map[string]*indexSegment)
+	for _, name := range idx.removed {
+		if err := os.Remove(filepath.Join(idx.Path, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	idx.removed = nil
+	return nil
+}
+
+// Files returns the path of every indexed log
+func (idx *LogIndex) Files() []string {
+	var paths []string
+	for _, f := range idx.manifest.Files {
+		paths = append(paths, f.Path)
+	}
+	return paths
+}
+
+// Len returns the number of indexed lines
+func (idx *LogIndex) Len() int {
+	var n int
+	for _, f := range idx.manifest.Files {
+		for _, s := range f.Segments {
+			n += s.Count
+		}
+	}
+	return n
+}
+
+// AddDir indexes every eqlog_*.txt in dir, returning the number of new lines indexed
+func (idx *LogIndex) AddDir(dir string) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "eqlog_*.txt"))
+	if err != nil {
+		return 0, err
+	}
+	var total int
+	for _, path := range paths {
+		n, err := idx.AddFile(path)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// AddFile indexes whatever has been appended to a log since it was last indexed, returning the number of new lines.
+// If the file was truncated or replaced only its own lines are dropped and indexed again.
+// A missing file returns an error and leaves the index untouched.
+func (idx *LogIndex) AddFile(path string) (int, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+	var f *indexedFile
+	for i := range idx.manifest.Files {
+		if idx.manifest.Files[i].Path == path {
+			f = &idx.manifest.Files[i]
+		}
+	}
+	var offset int64
+	if f != nil {
+		offset = f.Offset
+	}
+	head, size, err := fileHead(path, offset)
+	if err != nil {
+		return 0, err
+	}
+	if f == nil {
+		idx.manifest.Files = append(idx.manifest.Files, indexedFile{Path: path})
+		f = &idx.manifest.Files[len(idx.manifest.Files)-1]
+	}
+	if f.Offset > 0 && (size < f.Offset || head != f.Head) {
+		idx.dropSegments(f)
+	}
+	return idx.indexFrom(f)
+}
+
+// dropSegments forgets every line indexed from a file so it can be read again from the start
+func (idx *LogIndex) dropSegments(f *indexedFile) {
+	for _, s := range f.Segments {
+		delete(idx.dirty, s.Name)
+		idx.removed = append(idx.removed, s.Name)
+	}
+	f.Segments = nil
+	f.Offset = 0
+	f.Head = 0
+	f.Last = time.Time{}
+}
+
+func (idx *LogIndex) indexFrom(f *indexedFile) (int, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	if _, err := file.Seek(f.Offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	reader := bufio.NewReader(file)
+	parser := NewLogLineParser(idx.Location)
+	parser.Last = f.Last
+	var count int
+	var seg *indexSegment
+	var info *segmentInfo
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF { // a partial line is left for next time
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+		offset := f.Offset
+		f.Offset += int64(len(line))
+		log, err := parser.Parse(strings.TrimRight(line, "\r\n"))
+		if err != nil {
+			continue
+		}
+		f.Last = log.T
+		if info == nil || info.Count >= indexSegmentLines {
+			if seg, info, err = idx.tailSegment(f); err != nil {
+				return count, err
+			}
+		}
+		seg.add(indexEntry{Offset: offset, Length: uint32(len(line)), T: log.T.Unix()}, log)
+		if info.Count == 0 || log.T.Unix() < info.Start {
+			info.Start = log.T.Unix()
+		}
+		if info.Count == 0 || log.T.Unix() > info.End {
+			info.End = log.T.Unix()
+		}
+		info.Count++
+		count++
+	}
+	f.Head, _, err = fileHead(f.Path, f.Offset)
+	return count, err
+}
+
+// tailSegment returns the segment new lines from a file go in, starting a new one when the last is full
+func (idx *LogIndex) tailSegment(f *indexedFile) (*indexSegment, *segmentInfo, error) {
+	if n := len(f.Segments); n > 0 && f.Segments[n-1].Count < indexSegmentLines {
+		info := &f.Segments[n-1]
+		seg, err := idx.loadSegment(info.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		idx.dirty[info.Name] = seg
+		return seg, info, nil
+	}
+	name := fmt.Sprintf("%08d.seg", idx.manifest.Next)
+	idx.manifest.Next++
+	seg := newIndexSegment()
+	idx.dirty[name] = seg
+	f.Segments = append(f.Segments, segmentInfo{Name: name})
+	return seg, &f.Segments[len(f.Segments)-1], nil
+}
+
+// loadSegment returns a segment from memory if it hasn't been saved yet, otherwise from disk
+func (idx *LogIndex) loadSegment(name string) (*indexSegment, error) {
+	if seg, ok := idx.dirty[name]; ok {
+		seg.sort()
+		return seg, nil
+	}
+	seg := newIndexSegment()
+	if err := readGob(filepath.Join(idx.Path, name), seg); err != nil {
+		return nil, err
+	}
+	return seg, nil
+}
+
+func newIndexSegment() *indexSegment {
+	return &indexSegment{
+		Channels: make(map[string][]uint32),
+		Sources:  make(map[string][]uint32),
+		Terms:    make(map[string][]uint32),
+	}
+}
+
+func (s *indexSegment) add(e indexEntry, log *EqLog) {
+	if n := len(s.Entries); n > 0 && e.T < s.Entries[n-1].T {
+		s.unsorted = true
+	}
+	pos := uint32(len(s.Entries))
+	s.Entries = append(s.Entries, e)
+	s.Channels[log.Channel] = append(s.Channels[log.Channel], pos)
+	source := strings.ToLower(log.Source)
+	s.Sources[source] = append(s.Sources[source], pos)
+	for _, term := range indexTerms(log.Msg) {
+		s.Terms[term] = append(s.Terms[term], pos)
+	}
+}
+
+// sort puts entries back in time order after a clock change, moving every posting with them
+func (s *indexSegment) sort() {
+	if !s.unsorted {
+		return
+	}
+	order := make([]uint32, len(s.Entries))
+	for i := range order {
+		order[i] = uint32(i)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return s.Entries[order[i]].T < s.Entries[order[j]].T
+	})
+	moved := make([]uint32, len(order))
+	entries := make([]indexEntry, len(order))
+	for to, from := range order {
+		moved[from] = uint32(to)
+		entries[to] = s.Entries[from]
+	}
+	s.Entries = entries
+	for _, postings := range []map[string][]uint32{s.Channels, s.Sources, s.Terms} {
+		for key, ids := range postings {
+			for i, id := range ids {
+				ids[i] = moved[id]
+			}
+			sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+			postings[key] = ids
+		}
+	}
+	s.unsorted = false
+}
+
+// indexHit is a matched line and the file it came from
+type indexHit struct {
+	file  int
+	entry indexEntry
+}
+
+// Search returns every indexed line matching the query, ordered by time.
+// Lines from files that no longer exist are skipped.
+func (idx *LogIndex) Search(q LogQuery) ([]EqLog, error) {
+	start, end := int64(-1<<63), int64(1<<63-1)
+	if !q.Start.IsZero() {
+		start = q.Start.Unix()
+	}
+	if !q.End.IsZero() {
+		end = q.End.Unix()
+	}
+	var hits []indexHit
+	for fileID, f := range idx.manifest.Files {
+		for _, info := range f.Segments {
+			if info.Count == 0 || info.End < start || info.Start > end {
+				continue
+			}
+			seg, err := idx.loadSegment(info.Name)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range seg.search(q, start, end) {
+				hits = append(hits, indexHit{file: fileID, entry: e})
+			}
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].entry.T < hits[j].entry.T
+	})
+	return idx.readEntries(hits, q.Limit)
+}
+
+// search returns the entries in a segment matching the query between start and end, found by binary search on time
+func (s *indexSegment) search(q LogQuery, start, end int64) []indexEntry {
+	lo := sort.Search(len(s.Entries), func(i int) bool { return s.Entries[i].T >= start })
+	hi := sort.Search(len(s.Entries), func(i int) bool { return s.Entries[i].T > end })
+	if lo >= hi {
+		return nil
+	}
+
+	var candidates []uint32
+	filtered := false
+	narrow := func(ids []uint32) {
+		if !filtered {
+			candidates = ids
+			filtered = true
+			return
+		}
+		candidates = intersectIDs(candidates, ids)
+	}
+	for _, term := range q.Terms {
+		for _, word := range indexTerms(term) {
+			narrow(s.Terms[word])
+		}
+	}
+	if len(q.Channels) > 0 {
+		var ids []uint32
+		for _, channel := range q.Channels {
+			ids = unionIDs(ids, s.Channels[channel])
+		}
+		narrow(ids)
+	}
+	if len(q.Sources) > 0 {
+		var ids []uint32
+		for _, source := range q.Sources {
+			ids = unionIDs(ids, s.Sources[strings.ToLower(source)])
+		}
+		narrow(ids)
+	}
+	if !filtered {
+		return s.Entries[lo:hi]
+	}
+	first := sort.Search(len(candidates), func(i int) bool { return candidates[i] >= uint32(lo) })
+	var matches []indexEntry
+	for _, id := range candidates[first:] {
+		if id >= uint32(hi) {
+			break
+		}
+		matches = append(matches, s.Entries[id])
+	}
+	return matches
+}
+
+// readEntries reads matched lines back from their logs, stopping at limit when it is above 0
+func (idx *LogIndex) readEntries(hits []indexHit, limit int) ([]EqLog, error) {
+	files := make(map[int]*os.File)
+	missing := make(map[int]bool)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	var results []EqLog
+	for _, hit := range hits {
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+		if missing[hit.file] {
+			continue
+		}
+		path := idx.manifest.Files[hit.file].Path
+		file, ok := files[hit.file]
+		if !ok {
+			var err error
+			file, err = os.Open(path)
+			if os.IsNotExist(err) {
+				missing[hit.file] = true
+				continue
+			}
+			if err != nil {
+				return results, err
+			}
+			files[hit.file] = file
+		}
+		buf := make([]byte, hit.entry.Length)
+		if _, err := file.ReadAt(buf, hit.entry.Offset); err != nil {
+			return results, err
+		}
+		log, err := ParseLogLineIn(strings.TrimRight(string(buf), "\r\n"), idx.Location)
+		if err != nil {
+			return results, errors.New("index is out of date with " + path)
+		}
+		log.T = time.Unix(hit.entry.T, 0).In(log.T.Location()) // the indexed time had the lines around it to settle DST
+		results = append(results, *log)
+	}
+	return results, nil
+}
+
+// readGob decodes the gob file at path into v
+func readGob(path string, v interface{}) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return gob.NewDecoder(bufio.NewReader(file)).Decode(v)
+}
+
+// writeGob encodes v to path through a temporary file, so a failed write leaves the old file in place
+func writeGob(path string, v interface{}) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		return gob.NewEncoder(w).Encode(v)
+	})
+}
+
+// writeFileAtomic writes path through a temporary file renamed over it once write succeeds, so a failed write leaves the old file in place
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	if err := write(w); err != nil {
+		file.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// indexTerms splits a message into lower case words for the full text index
+func indexTerms(msg string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(msg), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '`'
+	}) {
+		if !seen[word] {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// fileHead returns a checksum of up to the first n bytes of a file, capped at indexHeadSize, along with its size
+func fileHead(path string, n int64) (uint32, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	if n > indexHeadSize {
+		n = indexHeadSize
+	}
+	buf := make([]byte, n)
+	read, err := io.ReadFull(file, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return 0, 0, err
+	}
+	return crc32.ChecksumIEEE(buf[:read]), info.Size(), nil
+}
+
+// intersectIDs returns the ids present in both sorted lists
+func intersectIDs(a, b []uint32) []uint32 {
+	var out []uint32
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// unionIDs merges two sorted lists of ids
+func unionIDs(a, b []uint32) []uint32 {
+	out := make([]uint32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			out = append(out, a[i])
+			i++
+		case a[i] > b[j]:
+			out = append(out, b[j])
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	out = append(out, a[i:]...)
+	return append(out, b[j:]...)
+}
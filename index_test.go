@@ -0,0 +1,105 @@
+package everquest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogIndex(t *testing.T) {
+	dir := t.TempDir()
+	mortimus := filepath.Join(dir, "eqlog_Mortimus_P1999Green.txt")
+	kaijin := filepath.Join(dir, "eqlog_Kaijin_P1999Green.txt")
+	os.WriteFile(mortimus, []byte(strings.Join([]string{
+		"[Sat Jan 02 20:44:08 2021] Destrod tells the guild, 'takings bids on Shawl of Perception pst'",
+		"[Sat Jan 02 20:45:00 2021] Kaijin tells the guild, 'Shawl of Perception 50'",
+		"[Sat Jan 02 20:46:00 2021] You have entered Veeshan's Peak.",
+		"",
+	}, "\n")), 0644)
+	os.WriteFile(kaijin, []byte("[Sat Jan 02 20:44:30 2021] Ryze tells the raid, 'shawl is up'\n"), 0644)
+
+	idx, err := OpenLogIndex(filepath.Join(dir, "index"))
+	if err != nil {
+		t.Fatalf("Error opening index: %v", err)
+	}
+	idx.Location = time.UTC
+	if n, err := idx.AddDir(dir); err != nil || n != 4 {
+		t.Fatalf("Error indexing dir, indexed %d lines: %v", n, err)
+	}
+	if err := idx.Save(); err != nil {
+		t.Fatalf("Error saving index: %v", err)
+	}
+	kept := filepath.Join(idx.Path, idx.manifest.Files[1].Segments[0].Name) // files are indexed in name order, Kaijin first
+	replaced := filepath.Join(idx.Path, idx.manifest.Files[0].Segments[0].Name)
+	saved, _ := os.Stat(kept)
+
+	idx, err = OpenLogIndex(idx.Path)
+	if err != nil {
+		t.Fatalf("Error reopening index: %v", err)
+	}
+	idx.Location = time.UTC
+	results, err := idx.Search(LogQuery{Terms: []string{"shawl"}})
+	if err != nil || len(results) != 3 || results[1].Source != "Ryze" {
+		t.Fatalf("Error searching terms across files: %+v %v", results, err)
+	}
+	results, _ = idx.Search(LogQuery{Channels: []string{"guild"}, Start: time.Date(2021, time.January, 2, 20, 44, 30, 0, time.UTC)})
+	if len(results) != 1 || results[0].Source != "Kaijin" {
+		t.Fatalf("Error searching channel and time: %+v", results)
+	}
+	results, _ = idx.Search(LogQuery{End: time.Date(2021, time.January, 2, 20, 45, 0, 0, time.UTC), Limit: 2})
+	if len(results) != 2 || results[1].Source != "Ryze" {
+		t.Fatalf("Error searching time range with limit: %+v", results)
+	}
+
+	// replacing one log only re-indexes that log
+	os.WriteFile(kaijin, []byte("[Sun Jan 03 19:00:00 2021] Ryze tells the raid, 'inc'\n[Sun Jan 03 19:00:05 2021] Ryze tells the raid, 'go'\n"), 0644)
+	if n, err := idx.AddFile(kaijin); err != nil || n != 2 {
+		t.Fatalf("Error re-indexing replaced file, indexed %d lines: %v", n, err)
+	}
+	if idx.Len() != 5 {
+		t.Fatalf("Error replacing lines, have %d", idx.Len())
+	}
+	if err := idx.Save(); err != nil {
+		t.Fatalf("Error saving index: %v", err)
+	}
+	if after, err := os.Stat(kept); err != nil || !os.SameFile(saved, after) {
+		t.Fatalf("Error untouched segment was rewritten: %v", err)
+	}
+	if _, err := os.Stat(replaced); !os.IsNotExist(err) {
+		t.Fatalf("Error replaced segment was not removed: %v", err)
+	}
+
+	// a missing log is reported and keeps its lines, searches skip it
+	os.Remove(kaijin)
+	if _, err := idx.AddFile(kaijin); err == nil || idx.Len() != 5 {
+		t.Fatalf("Error adding missing file changed the index, have %d lines: %v", idx.Len(), err)
+	}
+	results, err = idx.Search(LogQuery{})
+	if err != nil || len(results) != 3 {
+		t.Fatalf("Error searching with a missing file: %+v %v", results, err)
+	}
+}
+
+func TestIndexSegmentSort(t *testing.T) {
+	seg := newIndexSegment()
+	for i, line := range []string{
+		"[Sun Nov 07 01:59:00 2021] Kaijin tells the guild, 'one'",
+		"[Sun Nov 07 01:00:00 2021] Kaijin tells the guild, 'two'",
+		"[Sun Nov 07 01:30:00 2021] Ryze tells the guild, 'three'",
+	} {
+		log, _ := ParseLogLineIn(line, time.UTC)
+		seg.add(indexEntry{Offset: int64(i), T: log.T.Unix()}, log)
+	}
+	seg.sort()
+	if seg.Entries[0].Offset != 1 || seg.Entries[1].Offset != 2 || seg.Entries[2].Offset != 0 {
+		t.Fatalf("Error sorting entries: %+v", seg.Entries)
+	}
+	if ids := seg.Terms["one"]; len(ids) != 1 || ids[0] != 2 {
+		t.Fatalf("Error moving postings: %v", ids)
+	}
+	if ids := seg.Sources["kaijin"]; len(ids) != 2 || ids[0] != 0 || ids[1] != 2 {
+		t.Fatalf("Error sorting postings: %v", ids)
+	}
+}
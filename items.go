@@ -71,6 +71,42 @@ func (db *ItemDB) FindIDByName(name string) (int, error) {
 	return -1, errors.New("cannot find item id with name: " + name)
 }
 
+// FindClosestIDByName looks up an item by name allowing for small differences like plurals or typos, returns -1 if nothing is within maxDistance edits.
+// Short names allow fewer edits, one for every four letters, so they can't drift to an unrelated item, and a name equally close to more than one item is refused.
+func (db *ItemDB) FindClosestIDByName(name string, maxDistance int) (int, error) {
+	if id, err := db.FindIDByName(name); err == nil {
+		return id, nil
+	}
+	lower := strings.ToLower(name)
+	if limit := len(lower) / 4; limit < maxDistance {
+		maxDistance = limit
+	}
+	best := -1
+	bestDistance := maxDistance + 1
+	tied := false
+	for itemName, id := range db.names {
+		if abs(len(itemName)-len(lower)) > bestDistance { // cannot match the current best
+			continue
+		}
+		d := editDistance(lower, itemName)
+		switch {
+		case d < bestDistance:
+			best = id
+			bestDistance = d
+			tied = false
+		case d == bestDistance && best != -1:
+			tied = true
+		}
+	}
+	if best == -1 {
+		return -1, errors.New("cannot find item id close to name: " + name)
+	}
+	if tied {
+		return -1, errors.New("more than one item is as close to name: " + name)
+	}
+	return best, nil
+}
+
 // GetItemByID returns an item given its ID, returns an empty struct if not found
 func (db *ItemDB) GetItemByID(id int) (Item, error) {
 	if val, ok := db.items[id]; ok {
@@ -2190,3 +2226,41 @@ func (db *ItemDB) AddItem(item Item) error {
 	db.names[strings.ToLower(item.Name)] = item.ID
 	return nil
 }
+
+// editDistance returns the levenshtein distance between two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
@@ -0,0 +1,189 @@
+package everquest
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SpellLandingIndex recognises spells landing and fading from the cast messages in a SpellDB.
+// Castmsg3 is shown when a spell lands on you, Castmsg4 follows the target's name when it lands on someone else and Castmsg5 when it fades from you.
+type SpellLandingIndex struct {
+	Classes      []string      // Classes likely to be casting, spells they can use are preferred when messages are shared
+	MaxLevel     int           // Highest caster level, spells above it are ranked last, 0 for no limit
+	RecentWindow time.Duration // How long a cast seen in the log makes its spell the preferred match
+
+	spells  *SpellDB
+	onYou   map[string][]int // cast on you message -> spell ids
+	onOther map[string][]int // cast on other message starting with the character after the target's name -> spell ids
+	fades   map[string][]int // spell fades message -> spell ids
+	casts   map[string]spellCast
+}
+
+type spellCast struct {
+	T      time.Time
+	Caster string
+}
+
+var (
+	youBeginCastingRegex   = regexp.MustCompile(`^You begin casting (.+)\.$`)
+	otherBeginCastingRegex = regexp.MustCompile(`^(.+?) begins (?:casting (.+)\.|to cast a spell\. <(.+)>)$`)
+)
+
+// NewSpellLandingIndex indexes the cast messages of every spell in db
+func NewSpellLandingIndex(db *SpellDB) *SpellLandingIndex {
+	idx := &SpellLandingIndex{
+		RecentWindow: 30 * time.Second,
+		spells:       db,
+		onYou:        make(map[string][]int),
+		onOther:      make(map[string][]int),
+		fades:        make(map[string][]int),
+		casts:        make(map[string]spellCast),
+	}
+	for id, spell := range db.byID {
+		if msg := strings.TrimSpace(spell.Castmsg3); msg != "" {
+			idx.onYou[msg] = append(idx.onYou[msg], id)
+		}
+		if msg := strings.TrimRight(spell.Castmsg4, " "); strings.TrimSpace(msg) != "" {
+			if msg[0] != ' ' && msg[0] != '\'' { // most messages carry their own leading space, possessives start with 's
+				msg = " " + msg
+			}
+			idx.onOther[msg] = append(idx.onOther[msg], id)
+		}
+		if msg := strings.TrimSpace(spell.Castmsg5); msg != "" {
+			idx.fades[msg] = append(idx.fades[msg], id)
+		}
+	}
+	return idx
+}
+
+// Match returns a SpellLandedEvent or SpellFadedEvent for the log, false if it isn't a known cast message.
+// Casting messages are remembered to rank spells that share a message, so every log should be passed through Match.
+func (idx *SpellLandingIndex) Match(log EqLog) (Event, bool) {
+	msg := strings.TrimSpace(log.Msg)
+	if idx.addCast(log.T, msg) {
+		return nil, false
+	}
+	if ids, ok := idx.onYou[msg]; ok {
+		e := &SpellLandedEvent{EqLog: log, Target: "You"}
+		e.Candidates = idx.rank(ids, log.T)
+		e.Spell = e.Candidates[0]
+		e.Caster = idx.caster(e.Spell, log.T)
+		return e, true
+	}
+	for i := 1; i < len(msg); i++ {
+		if msg[i] != ' ' && msg[i] != '\'' {
+			continue
+		}
+		if ids, ok := idx.onOther[msg[i:]]; ok { // the first split is the longest message, so the most specific
+			e := &SpellLandedEvent{EqLog: log, Target: msg[:i]}
+			e.Candidates = idx.rank(ids, log.T)
+			e.Spell = e.Candidates[0]
+			e.Caster = idx.caster(e.Spell, log.T)
+			return e, true
+		}
+	}
+	if ids, ok := idx.fades[msg]; ok {
+		e := &SpellFadedEvent{EqLog: log, Target: "You"}
+		e.Candidates = idx.rank(ids, log.T)
+		e.Spell = e.Candidates[0]
+		return e, true
+	}
+	return nil, false
+}
+
+// Stream matches every log from in and sends landed and faded events to out until in is closed
+func (idx *SpellLandingIndex) Stream(in <-chan EqLog, out chan<- Event) {
+	for log := range in {
+		if e, ok := idx.Match(log); ok {
+			out <- e
+		}
+	}
+}
+
+// addCast remembers begin casting messages, returning true if msg was one
+func (idx *SpellLandingIndex) addCast(t time.Time, msg string) bool {
+	if m := youBeginCastingRegex.FindStringSubmatch(msg); m != nil {
+		idx.casts[strings.ToLower(m[1])] = spellCast{T: t, Caster: "You"}
+		return true
+	}
+	if m := otherBeginCastingRegex.FindStringSubmatch(msg); m != nil {
+		name := m[2]
+		if name == "" {
+			name = m[3]
+		}
+		idx.casts[strings.ToLower(name)] = spellCast{T: t, Caster: m[1]}
+		return true
+	}
+	return false
+}
+
+// recent returns the cast of a spell seen within RecentWindow of t
+func (idx *SpellLandingIndex) recent(spell Spell, t time.Time) (spellCast, bool) {
+	cast, ok := idx.casts[strings.ToLower(spell.Name)]
+	if !ok || t.Sub(cast.T) > idx.RecentWindow || t.Before(cast.T) {
+		return spellCast{}, false
+	}
+	return cast, true
+}
+
+func (idx *SpellLandingIndex) caster(spell Spell, t time.Time) string {
+	cast, _ := idx.recent(spell, t)
+	return cast.Caster
+}
+
+// rank orders spells sharing a message, recently cast first, then usable by Classes within MaxLevel, then highest level
+func (idx *SpellLandingIndex) rank(ids []int, t time.Time) []Spell {
+	type ranked struct {
+		spell Spell
+		score int
+		level int
+	}
+	var candidates []ranked
+	for _, id := range ids {
+		spell := idx.spells.byID[id]
+		r := ranked{spell: spell}
+		if _, ok := idx.recent(spell, t); ok {
+			r.score += 4
+		}
+		r.level = castableLevel(spell, idx.Classes)
+		if r.level > 0 {
+			r.score += 2
+		} else {
+			r.level = castableLevel(spell, allClasses)
+		}
+		if idx.MaxLevel == 0 || r.level <= idx.MaxLevel {
+			r.score++
+		}
+		candidates = append(candidates, r)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if a.level != b.level {
+			return a.level > b.level
+		}
+		return a.spell.Id < b.spell.Id
+	})
+	spells := make([]Spell, len(candidates))
+	for i, c := range candidates {
+		spells[i] = c.spell
+	}
+	return spells
+}
+
+var allClasses, _ = GetClassesByRole("All")
+
+// castableLevel returns the lowest level any of classes can cast the spell at, 0 if none of them can
+func castableLevel(spell Spell, classes []string) int {
+	var lowest int
+	for _, class := range classes {
+		if level := spell.ClassLevel(class); level > 0 && (lowest == 0 || level < lowest) {
+			lowest = level
+		}
+	}
+	return lowest
+}
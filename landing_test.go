@@ -0,0 +1,59 @@
+package everquest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSpellLandingRank(t *testing.T) {
+	db := &SpellDB{byID: make(map[int]Spell), byName: make(map[string]int)}
+	shared := Spell{Castmsg3: "You feel the spirit of wolf enter you.", Castmsg4: " feels the spirit of wolf enter them.", Castmsg5: "The spirit of wolf leaves you."}
+	wolf, pack := shared, shared
+	wolf.Id, wolf.Name, wolf.Shmlevel, wolf.Drulevel, wolf.Rnglevel = 1, "Spirit of Wolf", 9, 14, 28
+	pack.Id, pack.Name, pack.Shmlevel, pack.Drulevel, pack.Rnglevel = 2, "Pack Spirit", 255, 35, 255
+	db.byID[1], db.byID[2] = wolf, pack
+
+	start := time.Date(2021, time.January, 2, 20, 0, 0, 0, time.Local)
+	first := func(idx *SpellLandingIndex, offset int, msg string) Event {
+		e, ok := idx.Match(EqLog{T: start.Add(time.Duration(offset) * time.Second), Msg: msg})
+		if !ok {
+			t.Fatalf("Error matching %s", msg)
+		}
+		return e
+	}
+
+	idx := NewSpellLandingIndex(db)
+	landed := first(idx, 0, "You feel the spirit of wolf enter you.").(*SpellLandedEvent)
+	if landed.Spell.Name != "Pack Spirit" || len(landed.Candidates) != 2 {
+		t.Fatalf("Error ranking highest level first: %s", landed.Spell.Name)
+	}
+
+	idx.MaxLevel = 20
+	if landed := first(idx, 0, "You feel the spirit of wolf enter you.").(*SpellLandedEvent); landed.Spell.Name != "Spirit of Wolf" {
+		t.Fatalf("Error ranking spells above MaxLevel last: %s", landed.Spell.Name)
+	}
+
+	idx = NewSpellLandingIndex(db)
+	idx.Classes = []string{"Shaman"}
+	landed = first(idx, 0, "Ryze feels the spirit of wolf enter them.").(*SpellLandedEvent)
+	if landed.Spell.Name != "Spirit of Wolf" || landed.Target != "Ryze" || landed.Caster != "" {
+		t.Fatalf("Error ranking spells usable by Classes first: %+v", landed)
+	}
+
+	if _, ok := idx.Match(EqLog{T: start.Add(10 * time.Second), Msg: "Kaijin begins casting Pack Spirit."}); ok {
+		t.Fatalf("Error begin casting matched as a landing")
+	}
+	landed = first(idx, 15, "Ryze feels the spirit of wolf enter them.").(*SpellLandedEvent)
+	if landed.Spell.Name != "Pack Spirit" || landed.Caster != "Kaijin" {
+		t.Fatalf("Error ranking a recent cast first: %s by %s", landed.Spell.Name, landed.Caster)
+	}
+	landed = first(idx, 60, "Ryze feels the spirit of wolf enter them.").(*SpellLandedEvent)
+	if landed.Spell.Name != "Spirit of Wolf" || landed.Caster != "" {
+		t.Fatalf("Error cast outside RecentWindow still ranked first: %s by %s", landed.Spell.Name, landed.Caster)
+	}
+
+	faded := first(idx, 70, "The spirit of wolf leaves you.").(*SpellFadedEvent)
+	if faded.Spell.Name != "Spirit of Wolf" || faded.Target != "You" {
+		t.Fatalf("Error matching fade: %+v", faded)
+	}
+}
@@ -2,6 +2,7 @@ package everquest
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -17,34 +18,47 @@ type LogAlert interface {
 
 const EQBaseLogLine = "\\[(\\w{3} \\w{3} \\d{2} \\d{2}:\\d{2}:\\d{2} \\d{4})] (.+)"
 
+// EQLogTimeFormat is the layout of the timestamp at the start of every log line, it carries no zone
+const EQLogTimeFormat = "Mon Jan 02 15:04:05 2006"
+
+var eqBaseLogRegex = regexp.MustCompile(EQBaseLogLine)
+
+// BufferedLogRead sends every line of a log to out, reading timestamps as local time, see BufferedLogReadIn
 func BufferedLogRead(path string, fromStart bool, pollRate int, out chan EqLog, quit <-chan bool) {
+	BufferedLogReadIn(path, fromStart, pollRate, out, quit, time.Local)
+}
+
+// BufferedLogReadIn sends every line of a log to out until something is sent on quit, reading timestamps in loc.
+// Lines with a bad timestamp are reported to the standard logger and skipped.
+func BufferedLogReadIn(path string, fromStart bool, pollRate int, out chan EqLog, quit <-chan bool, loc *time.Location) {
 	file, err := os.Open(path)
 	if err != nil {
 		fmt.Printf("error opening buffered file: %v", err)
 		return
 	}
+	defer file.Close()
 	if !fromStart {
 		file.Seek(0, 2) // move to end of file
 	}
 	bufferedReader := bufio.NewReader(file)
-	r, _ := regexp.Compile(EQBaseLogLine)
+	parser := NewLogLineParser(loc)
 	for {
 		str, err := bufferedReader.ReadString('\n')
-		if err == io.EOF {
+		switch {
+		case err == io.EOF:
 			time.Sleep(time.Duration(pollRate) * time.Second) // 1 eq tick = 6 seconds
-			continue
-		}
-		if err != nil {
+		case err != nil:
 			log.Printf("error opening buffered file: %v", err)
 			return
-		}
-
-		results := r.FindAllStringSubmatch(str, -1) // this really needs converted to single search
-		if results == nil {
-			time.Sleep(3 * time.Second)
-		} else {
-			log := readLogLine(results)
-			out <- *log
+		default:
+			results := eqBaseLogRegex.FindAllStringSubmatch(str, -1) // this really needs converted to single search
+			if results == nil {
+				time.Sleep(3 * time.Second)
+			} else if eqlog, err := parser.read(results); err != nil {
+				log.Printf("error reading log line: %v", err)
+			} else {
+				out <- *eqlog
+			}
 		}
 		select {
 		case <-quit: // if someone sends true to the quit channel, exit the goroutine
@@ -54,8 +68,26 @@ func BufferedLogRead(path string, fromStart bool, pollRate int, out chan EqLog,
 	}
 }
 
-func readLogLine(results [][]string) *EqLog {
-	t := eqTimeConv(results[0][1])
+// ParseLogLine converts a single raw line from an eqlog file into an EqLog, reading the timestamp as local time
+func ParseLogLine(line string) (*EqLog, error) {
+	return ParseLogLineIn(line, time.Local)
+}
+
+// ParseLogLineIn converts a single raw line from an eqlog file into an EqLog.
+// The timestamp is read in loc, the zone of the machine that wrote the log, so lines either side of a DST change keep their real offset.
+func ParseLogLineIn(line string, loc *time.Location) (*EqLog, error) {
+	results := eqBaseLogRegex.FindAllStringSubmatch(line, -1)
+	if results == nil {
+		return nil, errors.New("not an everquest log line: " + line)
+	}
+	return readLogLine(results, loc)
+}
+
+func readLogLine(results [][]string, loc *time.Location) (*EqLog, error) {
+	t, err := eqTimeConv(results[0][1], loc)
+	if err != nil {
+		return nil, err
+	}
 	msg := strings.TrimSuffix(results[0][2], "\r")
 	log := &EqLog{
 		T:       t,
@@ -63,20 +95,77 @@ func readLogLine(results [][]string) *EqLog {
 		Channel: getChannel(msg),
 		Source:  getSource(msg),
 	}
-	return log
+	return log, nil
+}
+
+// eqTimeConv reads a log timestamp in loc, nil meaning local time.
+// The hour repeated when DST ends is ambiguous in the log itself and time.ParseInLocation doesn't promise which occurrence it picks,
+// so it is settled on the first. LogLineParser uses the lines before it to spot the second.
+func eqTimeConv(t string, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	cTime, err := time.ParseInLocation(EQLogTimeFormat, t, loc)
+	if err != nil {
+		return time.Time{}, errors.New("cannot parse log time " + t + ": " + err.Error())
+	}
+	if other, ok := otherOccurrence(cTime); ok && other.Before(cTime) {
+		return other, nil
+	}
+	return cTime, nil
 }
 
-func eqTimeConv(t string) time.Time {
-	// Get local time zone
-	zone, _ := time.Now().Zone()
+// otherOccurrence returns the other instant showing the same wall clock as t, ok is false unless t falls in the hour repeated when DST ends
+func otherOccurrence(t time.Time) (time.Time, bool) {
+	for _, shift := range []time.Duration{time.Hour, 30 * time.Minute, 2 * time.Hour} { // 30 minutes for Lord Howe Island
+		for _, other := range []time.Time{t.Add(shift), t.Add(-shift)} {
+			if sameClock(t, other) {
+				return other, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
 
-	// Parse Time
-	cTime, err := time.Parse("Mon Jan 02 15:04:05 2006 MST", t+" "+zone)
+func sameClock(a, b time.Time) bool {
+	ah, am, as := a.Clock()
+	bh, bm, bs := b.Clock()
+	return sameDay(a, b) && ah == bh && am == bm && as == bs
+}
+
+// LogLineParser reads the lines of a single log in order. Where a timestamp in the hour repeated when DST ends
+// would put a line before the one read ahead of it, the second occurrence is used instead.
+type LogLineParser struct {
+	Location *time.Location // Zone the log was written in, nil for local time
+	Last     time.Time      // Time of the line read last, set it to pick up a log part way through
+}
+
+// NewLogLineParser creates a parser for a log written in loc
+func NewLogLineParser(loc *time.Location) *LogLineParser {
+	return &LogLineParser{Location: loc}
+}
+
+// Parse converts the next raw line of the log into an EqLog
+func (p *LogLineParser) Parse(line string) (*EqLog, error) {
+	results := eqBaseLogRegex.FindAllStringSubmatch(line, -1)
+	if results == nil {
+		return nil, errors.New("not an everquest log line: " + line)
+	}
+	return p.read(results)
+}
+
+func (p *LogLineParser) read(results [][]string) (*EqLog, error) {
+	log, err := readLogLine(results, p.Location)
 	if err != nil {
-		// fmt.Printf("Error parsing time, defaulting to now: %s\n", err.Error())
-		cTime = time.Now()
+		return nil, err
 	}
-	return cTime
+	if log.T.Before(p.Last) {
+		if later, ok := otherOccurrence(log.T); ok && later.After(log.T) {
+			log.T = later
+		}
+	}
+	p.Last = log.T
+	return log, nil
 }
 
 // EqLog represents a single line of eq logging
@@ -87,37 +176,13 @@ type EqLog struct {
 	Source  string    `json:"Source"`
 }
 
+// getChannel returns the channel name stored on EqLog, custom channels are named ex: Von_parses
 func getChannel(msg string) string {
-	m := strings.Split(msg, " ")
-	if len(m) > 4 {
-		if m[3] == "guild," || m[4] == "guild," {
-			return "guild"
-		}
-		if m[3] == "group," || m[4] == "group," {
-			return "group"
-		}
-		if m[3] == "raid," || m[4] == "raid," {
-			return "raid"
-		}
-		if m[1] == "tells" && m[2] == "you," {
-			return "tell"
-		}
-	}
-	if len(m) > 2 && (m[1] == "tells" || m[1] == "tell") && strings.Contains(m[2], ":") { // channel message
-		// return m[3]
-		colLoc := strings.Index(m[2], ":")
-		return m[2][:colLoc]
-		// return "tell"
-		// return m[0] // source should show the player not the channel
-		// return strings.TrimRight(m[3], ",")
-	}
-	if len(m) > 1 && m[1] == "auctions," {
-		return "auction"
+	c := ClassifyMessage(msg)
+	if c.Channel == ChannelCustom {
+		return c.Name
 	}
-	if len(m) > 1 && m[1] == "says," {
-		return "say"
-	}
-	return "system"
+	return string(c.Channel)
 }
 
 func getSource(msg string) string {
@@ -130,3 +195,16 @@ func GetLogPath(player, server, basePath string) string {
 	player = strings.Title(player)   // first letter of player is uppercase
 	return basePath + "/Logs/eqlog_" + player + "_" + server + ".txt"
 }
+
+// ParseLogPath is the inverse of GetLogPath, returning the player and server an eqlog file belongs to
+func ParseLogPath(path string) (player, server string, err error) {
+	base := path[strings.LastIndexAny(path, "/\\")+1:]
+	if !strings.HasPrefix(base, "eqlog_") || !strings.HasSuffix(base, ".txt") {
+		return "", "", errors.New("not an everquest log path: " + path)
+	}
+	parts := strings.SplitN(strings.TrimSuffix(strings.TrimPrefix(base, "eqlog_"), ".txt"), "_", 2) // player names cannot contain underscores
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.New("not an everquest log path: " + path)
+	}
+	return parts[0], parts[1], nil
+}
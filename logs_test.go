@@ -1,14 +1,20 @@
 package everquest
 
 import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 )
 
 func TestGetChannel(t *testing.T) {
 	chanMSG := `Ravnor tells Von_parses:5, 'Lord Vyemm in 485s, 249k AH | Kaijin 22042 AH | Voltha 18485 AH | Patchouli 17664 AH | Silvaefar 17092 AH | Bunzz 17062 AH | Milliardo 15491 AH | Scylla 14543 AH | Vinadru 13840 AH | Porrt 13074 AH | Blossom 12927 AH | Impulse 12661 AH | Clearwater 10482 AH | Stony 9390 AH | Sacristan 8511 AH | Banis 7346 AH'`
-	sysMSG := `Patchouli winces.`
+	sysMSG := `You have entered The Plane of Knowledge.`
+	emoteMSG := `Patchouli winces.`
 	guildMSG := `Zobac tells the guild, 'Gratz Banis and Guzz!! :P'`
 	tellMSG := `Zortax tells you, 'no idea , havent spoken to either of them in a while .  I assume holidays , but you never know'`
 	raidMSG := `Ryze tells the raid, 'anyone else i missed let me know'`
@@ -37,16 +43,64 @@ func TestGetChannel(t *testing.T) {
 	if getChannel(sysMSG) != "system" {
 		t.Fatalf("Error reading system channel\n")
 	}
+	if getChannel(emoteMSG) != "emote" {
+		t.Fatalf("Error reading emote channel\n")
+	}
 	if getChannel(chanMSG) != "Von_parses" {
 		t.Fatalf("Error reading Von_parses channel\n%s\nshows as\n%s", chanMSG, getChannel(chanMSG))
 	}
 }
 
+func TestClassifyMessage(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want ChatMessage
+	}{
+		{`Zobac tells the guild, 'Gratz Banis and Guzz!! :P'`, ChatMessage{Channel: ChannelGuild, Direction: ChatIncoming, Speaker: "Zobac", Body: "Gratz Banis and Guzz!! :P"}},
+		{`You say to your guild, 'grats'`, ChatMessage{Channel: ChannelGuild, Direction: ChatOutgoing, Speaker: "You", Body: "grats"}},
+		{`Glooping tells the group, 'inc'`, ChatMessage{Channel: ChannelGroup, Direction: ChatIncoming, Speaker: "Glooping", Body: "inc"}},
+		{`You tell your party, 'oom'`, ChatMessage{Channel: ChannelGroup, Direction: ChatOutgoing, Speaker: "You", Body: "oom"}},
+		{`Ryze tells the raid, 'anyone else i missed let me know'`, ChatMessage{Channel: ChannelRaid, Direction: ChatIncoming, Speaker: "Ryze", Body: "anyone else i missed let me know"}},
+		{`You tell your raid, 'ready'`, ChatMessage{Channel: ChannelRaid, Direction: ChatOutgoing, Speaker: "You", Body: "ready"}},
+		{`Zortax tells you, 'no idea'`, ChatMessage{Channel: ChannelTell, Direction: ChatIncoming, Speaker: "Zortax", Target: "You", Body: "no idea"}},
+		{`You told Zortax, 'hi'`, ChatMessage{Channel: ChannelTell, Direction: ChatOutgoing, Speaker: "You", Target: "Zortax", Body: "hi"}},
+		{`Bunzz says, 'Hail, Charybdis'`, ChatMessage{Channel: ChannelSay, Direction: ChatIncoming, Speaker: "Bunzz", Body: "Hail, Charybdis"}},
+		{`You say, 'Hail, Charybdis'`, ChatMessage{Channel: ChannelSay, Direction: ChatOutgoing, Speaker: "You", Body: "Hail, Charybdis"}},
+		{`Scylla auctions, 'WTS Complete Heal'`, ChatMessage{Channel: ChannelAuction, Direction: ChatIncoming, Speaker: "Scylla", Body: "WTS Complete Heal"}},
+		{`You auction, 'WTB Shawl'`, ChatMessage{Channel: ChannelAuction, Direction: ChatOutgoing, Speaker: "You", Body: "WTB Shawl"}},
+		{`Xibab says out of character, 'LFG'`, ChatMessage{Channel: ChannelOOC, Direction: ChatIncoming, Speaker: "Xibab", Body: "LFG"}},
+		{`You say out of character, 'train to zone'`, ChatMessage{Channel: ChannelOOC, Direction: ChatOutgoing, Speaker: "You", Body: "train to zone"}},
+		{`Xibab shouts, 'help'`, ChatMessage{Channel: ChannelShout, Direction: ChatIncoming, Speaker: "Xibab", Body: "help"}},
+		{`You shout, 'help'`, ChatMessage{Channel: ChannelShout, Direction: ChatOutgoing, Speaker: "You", Body: "help"}},
+		{`Xibab tells the fellowship, 'camp check'`, ChatMessage{Channel: ChannelFellowship, Direction: ChatIncoming, Speaker: "Xibab", Body: "camp check"}},
+		{`You tell your fellowship, 'here'`, ChatMessage{Channel: ChannelFellowship, Direction: ChatOutgoing, Speaker: "You", Body: "here"}},
+		{`Ravnor tells General:3, 'anyone selling bone chips'`, ChatMessage{Channel: ChannelCustom, Direction: ChatIncoming, Name: "General", Number: 3, Speaker: "Ravnor", Body: "anyone selling bone chips"}},
+		{`You tell Von_parses:5, 'Lord Vyemm in 485s'`, ChatMessage{Channel: ChannelCustom, Direction: ChatOutgoing, Name: "Von_parses", Number: 5, Speaker: "You", Body: "Lord Vyemm in 485s"}},
+		{`Gobekn told you, 'Attacking a cave bear Master.'`, ChatMessage{Channel: ChannelPet, Direction: ChatIncoming, Speaker: "Gobekn", Body: "Attacking a cave bear Master."}},
+		{"Xibab`s warder told you, 'Following you, Master.'", ChatMessage{Channel: ChannelPet, Direction: ChatIncoming, Speaker: "Xibab`s warder", Body: "Following you, Master."}},
+		{`Guard Tolon says, 'Move along, citizen.'`, ChatMessage{Channel: ChannelNPC, Direction: ChatIncoming, Speaker: "Guard Tolon", Body: "Move along, citizen."}},
+		{`Kaezul says 'You will not leave this place alive!'`, ChatMessage{Channel: ChannelNPC, Direction: ChatIncoming, Speaker: "Kaezul", Body: "You will not leave this place alive!"}},
+		{`Patchouli winces.`, ChatMessage{Channel: ChannelEmote, Direction: ChatIncoming, Speaker: "Patchouli", Body: "winces."}},
+		{`Patchouli waves at Xibab.`, ChatMessage{Channel: ChannelEmote, Direction: ChatIncoming, Speaker: "Patchouli", Body: "waves at Xibab."}},
+		{`You cry.`, ChatMessage{Channel: ChannelEmote, Direction: ChatOutgoing, Speaker: "You", Body: "cry."}},
+		{`You have entered The Plane of Knowledge.`, ChatMessage{Channel: ChannelSystem, Body: "You have entered The Plane of Knowledge."}},
+		{`Xibab hits a cave bear for 52 points of damage.`, ChatMessage{Channel: ChannelSystem, Body: "Xibab hits a cave bear for 52 points of damage."}},
+	}
+	for _, test := range tests {
+		if got := ClassifyMessage(test.msg); got != test.want {
+			t.Errorf("ClassifyMessage(%q)\ngot  %+v\nwant %+v", test.msg, got, test.want)
+		}
+	}
+}
+
 func TestReadLogLine(t *testing.T) {
 	testLog := `[Sat Jan 02 20:44:08 2021] Destrod tells the guild, 'takings bids on Shawl of Perception pst bids close in 2mins'`
 	r, _ := regexp.Compile(EQBaseLogLine)
 	results := r.FindAllStringSubmatch(testLog, -1)
-	eqlog := readLogLine(results)
+	eqlog, err := readLogLine(results, time.Local)
+	if err != nil {
+		t.Fatalf("Error reading log line: %s", err)
+	}
 	testTime := time.Date(2021, time.January, 2, 20, 44, 8, 0, time.Local)
 	if eqlog.Channel != "guild" {
 		t.Fatalf("Error parsing channel")
@@ -64,11 +118,137 @@ func TestReadLogLine(t *testing.T) {
 
 func TestEQTimeConv(t *testing.T) {
 	testTime := "Sat May 23 20:44:08 2021"
-	conv := eqTimeConv(testTime)
+	conv, err := eqTimeConv(testTime, nil)
+	if err != nil {
+		t.Fatalf("Error parsing eq time: %s", err)
+	}
 	passTime := time.Date(2021, time.May, 23, 20, 44, 8, 0, time.Local)
 	if !conv.Equal(passTime) {
 		t.Fatalf("Error parsing eq time to time.Time: %s vs %s", conv.String(), passTime.String())
 	}
+	if _, err := eqTimeConv("Sat May 32 20:44:08 2021", nil); err == nil {
+		t.Fatalf("Invalid eq time should not parse")
+	}
+}
+
+func TestParseLogLineIn(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("No zone info: %s", err)
+	}
+	winter, err := ParseLogLineIn("[Sat Jan 02 20:44:08 2021] You have entered The Plane of Knowledge.", loc)
+	if err != nil {
+		t.Fatalf("Error parsing winter log: %s", err)
+	}
+	summer, err := ParseLogLineIn("[Sat Jul 03 20:44:08 2021] You have entered The Plane of Knowledge.", loc)
+	if err != nil {
+		t.Fatalf("Error parsing summer log: %s", err)
+	}
+	if _, offset := winter.T.Zone(); offset != -5*60*60 {
+		t.Fatalf("Winter log should be EST, got offset %d", offset)
+	}
+	if _, offset := summer.T.Zone(); offset != -4*60*60 {
+		t.Fatalf("Summer log should be EDT, got offset %d", offset)
+	}
+	if !winter.T.Equal(time.Date(2021, time.January, 3, 1, 44, 8, 0, time.UTC)) {
+		t.Fatalf("Winter log read as %s", winter.T)
+	}
+}
+
+func TestLogLineParserFallBack(t *testing.T) {
+	zones := []struct {
+		zone  string
+		lines []string
+		want  []string // utc
+	}{
+		{"America/New_York", []string{
+			"[Sun Nov 07 01:30:00 2021] first pass",
+			"[Sun Nov 07 01:59:59 2021] end of daylight time",
+			"[Sun Nov 07 01:00:00 2021] clocks went back",
+			"[Sun Nov 07 01:30:00 2021] second pass",
+			"[Sun Nov 07 02:00:00 2021] standard time",
+		}, []string{"05:30:00", "05:59:59", "06:00:00", "06:30:00", "07:00:00"}},
+		{"Europe/London", []string{
+			"[Sun Oct 31 01:30:00 2021] first pass",
+			"[Sun Oct 31 01:10:00 2021] clocks went back",
+			"[Sun Oct 31 01:30:00 2021] second pass",
+		}, []string{"00:30:00", "01:10:00", "01:30:00"}},
+	}
+	for _, z := range zones {
+		loc, err := time.LoadLocation(z.zone)
+		if err != nil {
+			t.Skipf("No zone info: %s", err)
+		}
+		if first, _ := ParseLogLineIn(z.lines[0], loc); first.T.UTC().Format("15:04:05") != z.want[0] {
+			t.Fatalf("Error %s ambiguous time should read as the first occurrence, got %s", z.zone, first.T.UTC())
+		}
+		parser := NewLogLineParser(loc)
+		for i, line := range z.lines {
+			log, err := parser.Parse(line)
+			if err != nil {
+				t.Fatalf("Error parsing %s: %s", line, err)
+			}
+			if got := log.T.UTC().Format("15:04:05"); got != z.want[i] {
+				t.Fatalf("Error %s line %d read as %s, want %s", z.zone, i, got, z.want[i])
+			}
+		}
+	}
+}
+
+func TestBufferedLogReadIn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "eqlog_Mortimus_P1999Green.txt")
+	os.WriteFile(path, []byte("[Sat Feb 30 20:44:08 2021] bad time\n[Sat Jan 02 20:44:08 2021] You have entered The Plane of Knowledge.\n"), 0644)
+	var reported bytes.Buffer
+	log.SetOutput(&reported)
+	defer log.SetOutput(os.Stderr)
+	out := make(chan EqLog, 2)
+	quit := make(chan bool)
+	done := make(chan struct{})
+	go func() {
+		BufferedLogReadIn(path, true, 0, out, quit, time.UTC)
+		close(done)
+	}()
+	select {
+	case eqlog := <-out:
+		if !eqlog.T.Equal(time.Date(2021, time.January, 2, 20, 44, 8, 0, time.UTC)) {
+			t.Fatalf("Error reading line after a bad time: %+v", eqlog)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Error line after a bad time was not sent")
+	}
+	select {
+	case quit <- true:
+	case <-time.After(time.Second):
+		t.Fatalf("Error quit was not checked")
+	}
+	<-done
+	if !strings.Contains(reported.String(), "cannot parse log time Sat Feb 30") {
+		t.Fatalf("Error bad time was not reported: %s", reported.String())
+	}
+}
+
+func TestFormatLogLine(t *testing.T) {
+	line := "[Sat Jan 02 20:44:08 2021] Destrod tells the guild, 'takings bids on Shawl of Perception pst bids close in 2mins'"
+	log, err := ParseLogLine(line)
+	if err != nil {
+		t.Fatalf("Error parsing log line: %s", err)
+	}
+	if got := FormatLogLine(*log); got != line {
+		t.Fatalf("Error formatting log line, got %s", got)
+	}
+	var b strings.Builder
+	w := NewLogWriter(&b)
+	w.Location = time.UTC
+	if err := w.WriteLog(*log); err != nil {
+		t.Fatalf("Error writing log: %s", err)
+	}
+	again, err := ParseLogLineIn(strings.TrimSuffix(b.String(), "\n"), time.UTC)
+	if err != nil {
+		t.Fatalf("Error parsing written log: %s", err)
+	}
+	if !again.T.Equal(log.T) || again.Msg != log.Msg || again.Channel != log.Channel || again.Source != log.Source {
+		t.Fatalf("Error round tripping log, got %+v want %+v", again, log)
+	}
 }
 
 func TestGetSource(t *testing.T) {
@@ -87,3 +267,17 @@ func TestGetLogPath(t *testing.T) {
 		t.Fatalf("Error getting log path of player")
 	}
 }
+
+func TestParseLogPath(t *testing.T) {
+	player, server, err := ParseLogPath("C:/Everquest/Logs/eqlog_Mortimus_aradune.txt")
+	if err != nil || player != "Mortimus" || server != "aradune" {
+		t.Fatalf("Error parsing log path: %s %s %v", player, server, err)
+	}
+	player, server, err = ParseLogPath(`C:\Everquest\Logs\eqlog_Mortimus_test_server.txt`)
+	if err != nil || player != "Mortimus" || server != "test_server" {
+		t.Fatalf("Error parsing windows log path: %s %s %v", player, server, err)
+	}
+	if _, _, err := ParseLogPath("C:/Everquest/Logs/dbg.txt"); err == nil {
+		t.Fatalf("Error parsing non log path should fail")
+	}
+}
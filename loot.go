@@ -0,0 +1,151 @@
+package everquest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LootRecord is a single looted item resolved against the item database
+type LootRecord struct {
+	T            time.Time `json:"time"`
+	Looter       string    `json:"looter"`
+	Item         string    `json:"item"`
+	ItemID       int       `json:"itemId"` // -1 if the item could not be found
+	Count        int       `json:"count"`
+	Corpse       string    `json:"corpse,omitempty"`
+	Zone         string    `json:"zone,omitempty"`
+	MasterLooter string    `json:"masterLooter,omitempty"`
+}
+
+// LootTracker collects loot from a log stream
+type LootTracker struct {
+	LogOwner
+	Items         *ItemDB // Used to resolve item ids, may be nil
+	MaxFuzzyEdits int     // Edits allowed when an item name doesn't match exactly, 0 disables fuzzy matching
+	Zone          string  // Zone the log owner is in, updated from zone changes
+
+	loot   []LootRecord
+	misses map[string]bool // names the item database had nothing close to, so they aren't searched for again
+}
+
+// NewLootTracker creates a tracker for the log of character, resolving items against items
+func NewLootTracker(character string, items *ItemDB) *LootTracker {
+	return &LootTracker{
+		LogOwner:      LogOwner{Character: character},
+		Items:         items,
+		MaxFuzzyEdits: 3,
+	}
+}
+
+// Add parses a log and records it if it is loot
+func (t *LootTracker) Add(log EqLog) {
+	if e, ok := t.parse(log); ok {
+		t.AddEvent(e)
+	}
+}
+
+// AddEvent records an already parsed event, zone changes are tracked to tag the loot that follows
+func (t *LootTracker) AddEvent(e Event) {
+	switch ev := e.(type) {
+	case *ZoneEvent:
+		t.Zone = ev.Zone
+	case *LootEvent:
+		record := LootRecord{
+			T:            ev.T,
+			Looter:       t.resolveName(ev.Looter),
+			Item:         ev.Item,
+			ItemID:       t.resolveItem(ev.Item),
+			Count:        ev.Count,
+			Corpse:       ev.Corpse,
+			Zone:         t.Zone,
+			MasterLooter: ev.Giver,
+		}
+		t.loot = append(t.loot, record)
+	}
+}
+
+// Loot returns every recorded item in order
+func (t *LootTracker) Loot() []LootRecord {
+	return t.loot
+}
+
+// Between returns the items looted between start and end, inclusive
+func (t *LootTracker) Between(start, end time.Time) []LootRecord {
+	var results []LootRecord
+	for _, record := range t.loot {
+		if !record.T.Before(start) && !record.T.After(end) {
+			results = append(results, record)
+		}
+	}
+	return results
+}
+
+// Night returns the items looted on the same raid night as t, see RaidNight
+func (t *LootTracker) Night(night time.Time) []LootRecord {
+	night = RaidNight(night)
+	var results []LootRecord
+	for _, record := range t.loot {
+		if RaidNight(record.T).Equal(night) {
+			results = append(results, record)
+		}
+	}
+	return results
+}
+
+// ByLooter returns every item looted by a player
+func (t *LootTracker) ByLooter(name string) []LootRecord {
+	var results []LootRecord
+	for _, record := range t.loot {
+		if record.Looter == name {
+			results = append(results, record)
+		}
+	}
+	return results
+}
+
+func (t *LootTracker) resolveItem(name string) int {
+	if t.Items == nil {
+		return -1
+	}
+	if id, err := t.Items.FindIDByName(name); err == nil {
+		return id
+	}
+	if t.MaxFuzzyEdits <= 0 || t.misses[strings.ToLower(name)] {
+		return -1
+	}
+	if id, err := t.Items.FindClosestIDByName(name, t.MaxFuzzyEdits); err == nil {
+		return id
+	}
+	if t.misses == nil {
+		t.misses = make(map[string]bool)
+	}
+	t.misses[strings.ToLower(name)] = true
+	return -1
+}
+
+// WriteLootCSV writes loot records as csv with a header row
+func WriteLootCSV(w io.Writer, records []LootRecord) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"Time", "Looter", "Item", "ItemID", "Count", "Corpse", "Zone", "MasterLooter"}); err != nil {
+		return err
+	}
+	for _, r := range records {
+		row := []string{r.T.Format(time.RFC3339), r.Looter, r.Item, strconv.Itoa(r.ItemID), strconv.Itoa(r.Count), r.Corpse, r.Zone, r.MasterLooter}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteLootJSON writes loot records as a json array
+func WriteLootJSON(w io.Writer, records []LootRecord) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(records)
+}
@@ -0,0 +1,95 @@
+package everquest
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLootTracker(t *testing.T) {
+	items := &ItemDB{items: make(map[int]Item), names: make(map[string]int)}
+	items.AddItem(Item{ID: 2463, Name: "Shawl of Perception"})
+	items.AddItem(Item{ID: 13073, Name: "Bone Chips"})
+	start := time.Date(2021, time.January, 2, 20, 0, 0, 0, time.UTC)
+	lines := []string{
+		"You have entered Veeshan's Peak.",
+		"--You have looted a Shawl of Perception from Lord Vyemm's corpse.--",
+		"--Kaijin has looted 3 Bone Chip from a skeleton's corpse.--", // fuzzy, missing the plural
+		"--Kaijin has looted a Tome of Forgotten Things from a skeleton's corpse.--",
+	}
+	tracker := NewLootTracker("Mortimus", items)
+	for i, line := range lines {
+		tracker.Add(EqLog{T: start.Add(time.Duration(i) * time.Second), Msg: line})
+	}
+
+	loot := tracker.Loot()
+	if len(loot) != 3 {
+		t.Fatalf("Error tracking loot, got %d records", len(loot))
+	}
+	if loot[0].Looter != "Mortimus" || loot[0].ItemID != 2463 || loot[0].Corpse != "Lord Vyemm" || loot[0].Zone != "Veeshan's Peak" {
+		t.Fatalf("Error recording loot: %+v", loot[0])
+	}
+	if loot[1].ItemID != 13073 || loot[1].Count != 3 {
+		t.Fatalf("Error fuzzy matching item: %+v", loot[1])
+	}
+	if loot[2].ItemID != -1 {
+		t.Fatalf("Error unknown item resolved to %d", loot[2].ItemID)
+	}
+	tracker.MaxFuzzyEdits = 0
+	if id := tracker.resolveItem("Bone Chip"); id != -1 {
+		t.Fatalf("Error fuzzy matching while disabled, got %d", id)
+	}
+	if kaijin := tracker.ByLooter("Kaijin"); len(kaijin) != 2 {
+		t.Fatalf("Error filtering by looter: %+v", kaijin)
+	}
+
+	var csv bytes.Buffer
+	if err := WriteLootCSV(&csv, loot[:1]); err != nil {
+		t.Fatalf("Error writing csv: %v", err)
+	}
+	want := "Time,Looter,Item,ItemID,Count,Corpse,Zone,MasterLooter\n2021-01-02T20:00:01Z,Mortimus,Shawl of Perception,2463,1,Lord Vyemm,Veeshan's Peak,\n"
+	if csv.String() != want {
+		t.Fatalf("Error writing csv, got\n%s", csv.String())
+	}
+
+	var js bytes.Buffer
+	if err := WriteLootJSON(&js, loot); err != nil {
+		t.Fatalf("Error writing json: %v", err)
+	}
+	if strings.Contains(js.String(), "masterLooter") {
+		t.Fatalf("Error omitting empty master looter: %s", js.String())
+	}
+	var decoded []LootRecord
+	if err := json.Unmarshal(js.Bytes(), &decoded); err != nil {
+		t.Fatalf("Error reading json back: %v", err)
+	}
+	if len(decoded) != 3 || !decoded[1].T.Equal(loot[1].T) || decoded[1].Item != loot[1].Item || decoded[1].ItemID != loot[1].ItemID {
+		t.Fatalf("Error round tripping json: %+v", decoded)
+	}
+}
+
+func TestFindClosestIDByName(t *testing.T) {
+	items := &ItemDB{items: make(map[int]Item), names: make(map[string]int)}
+	items.AddItem(Item{ID: 1, Name: "Stone"})
+	items.AddItem(Item{ID: 2, Name: "Rune"})
+	items.AddItem(Item{ID: 3, Name: "Wolf Pelts"})
+	items.AddItem(Item{ID: 4, Name: "Wolf Belt"})
+	items.AddItem(Item{ID: 5, Name: "Cloak of Flames"})
+
+	if id, err := items.FindClosestIDByName("Cloak of Flame", 3); err != nil || id != 5 {
+		t.Fatalf("Error fuzzy matching a plural: %d %v", id, err)
+	}
+	if id, err := items.FindClosestIDByName("Bone", 3); err == nil {
+		t.Fatalf("Error short name matched an unrelated item: %d", id)
+	}
+	if id, err := items.FindClosestIDByName("Wolf Pelt", 3); err == nil {
+		t.Fatalf("Error picking one of two equally close items: %d", id)
+	}
+
+	tracker := NewLootTracker("Mortimus", items)
+	if id := tracker.resolveItem("Bone"); id != -1 || !tracker.misses["bone"] {
+		t.Fatalf("Error caching a missed item name: %d", id)
+	}
+}
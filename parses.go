@@ -0,0 +1,235 @@
+package everquest
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseSummary is a damage parse posted to chat, the inverse of Encounter.Summary
+// ex: Lord Vyemm in 485s, 249k AH | Kaijin 22042 AH | Voltha 18485 AH
+type ParseSummary struct {
+	T        time.Time     `json:"time"`
+	Poster   string        `json:"poster,omitempty"`
+	Channel  string        `json:"channel,omitempty"`
+	Mob      string        `json:"mob"`
+	Duration time.Duration `json:"duration"`
+	Total    int           `json:"total"` // Approximate when the poster abbreviated it ex: 249k
+	Label    string        `json:"label,omitempty"`
+	Players  []ParsePlayer `json:"players"`
+}
+
+// ParsePlayer is one player's line of a parse
+type ParsePlayer struct {
+	Name   string `json:"name"`
+	Damage int    `json:"damage"`
+}
+
+// DPS returns a player's damage per second over the parse, 0 if they aren't in it
+func (p *ParseSummary) DPS(name string) float64 {
+	for _, player := range p.Players {
+		if strings.EqualFold(player.Name, name) {
+			d := p.Duration
+			if d < time.Second {
+				d = time.Second
+			}
+			return float64(player.Damage) / d.Seconds()
+		}
+	}
+	return 0
+}
+
+// key identifies a fight regardless of who posted it or when
+func (p *ParseSummary) key() string {
+	players := make([]string, len(p.Players))
+	for i, player := range p.Players {
+		players[i] = strings.ToLower(player.Name) + "=" + strconv.Itoa(player.Damage)
+	}
+	sort.Strings(players)
+	return strings.ToLower(p.Mob) + "|" + strconv.Itoa(int(p.Duration.Seconds())) + "|" + strings.Join(players, ",")
+}
+
+var (
+	parseHeaderRegex = regexp.MustCompile(`^(.+) in (\d+)s, (\d+(?:\.\d+)?)([kKmMbB]?)(?: (\S+))?$`)
+	parsePlayerRegex = regexp.MustCompile(`^(.+?) (\d+)(?: (\S+))?$`)
+)
+
+// ParseSummaryMessage reads a parse from the body of a chat message
+func ParseSummaryMessage(msg string) (*ParseSummary, error) {
+	parts := strings.Split(strings.TrimSpace(msg), "|")
+	m := parseHeaderRegex.FindStringSubmatch(strings.TrimSpace(parts[0]))
+	if m == nil {
+		return nil, errors.New("not a parse summary: " + msg)
+	}
+	seconds, _ := strconv.Atoi(m[2])
+	total, _ := strconv.ParseFloat(m[3], 64)
+	switch strings.ToLower(m[4]) {
+	case "k":
+		total *= 1000
+	case "m":
+		total *= 1000000
+	case "b":
+		total *= 1000000000
+	}
+	summary := &ParseSummary{
+		Mob:      m[1],
+		Duration: time.Duration(seconds) * time.Second,
+		Total:    int(total),
+		Label:    m[5],
+	}
+	for _, part := range parts[1:] {
+		p := parsePlayerRegex.FindStringSubmatch(strings.TrimSpace(part))
+		if p == nil {
+			return nil, errors.New("cannot read parse entry: " + part)
+		}
+		damage, _ := strconv.Atoi(p[2])
+		summary.Players = append(summary.Players, ParsePlayer{Name: p[1], Damage: damage})
+	}
+	if len(summary.Players) == 0 {
+		return nil, errors.New("parse summary has no players: " + msg)
+	}
+	return summary, nil
+}
+
+// ParseSummaryLog reads a parse posted in any chat channel, false if the log isn't one
+func ParseSummaryLog(log EqLog) (*ParseSummary, bool) {
+	chat := ClassifyMessage(log.Msg)
+	if chat.Channel == ChannelSystem || chat.Body == "" {
+		return nil, false
+	}
+	summary, err := ParseSummaryMessage(chat.Body)
+	if err != nil {
+		return nil, false
+	}
+	summary.T = log.T
+	summary.Poster = chat.Speaker
+	summary.Channel = log.Channel
+	return summary, true
+}
+
+// PlayerParse is one player's result from a stored parse
+type PlayerParse struct {
+	T        time.Time
+	Mob      string
+	Duration time.Duration
+	Damage   int
+	DPS      float64
+	Rank     int // Position in the parse, 1 for the top
+	Players  int // Number of players in the parse
+}
+
+// ParseStore keeps parses posted to chat on disk, ignoring reposts of the same fight
+type ParseStore struct {
+	Path         string        // Where the store is saved as json
+	DedupeWindow time.Duration // Identical parses posted within this long of each other are the same fight, defaults to 30 minutes
+
+	summaries []ParseSummary
+}
+
+// OpenParseStore loads the parses stored at path, or starts an empty store if it doesn't exist yet
+func OpenParseStore(path string) (*ParseStore, error) {
+	store := &ParseStore{Path: path, DedupeWindow: 30 * time.Minute}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.summaries); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Add stores a parse, returning false if it is a repost of one already stored
+func (s *ParseStore) Add(summary ParseSummary) bool {
+	window := s.DedupeWindow
+	if window <= 0 {
+		window = 30 * time.Minute
+	}
+	key := summary.key()
+	for i := len(s.summaries) - 1; i >= 0; i-- {
+		stored := s.summaries[i]
+		gap := summary.T.Sub(stored.T)
+		if gap < 0 {
+			gap = -gap
+		}
+		if gap <= window && stored.key() == key {
+			return false
+		}
+	}
+	s.summaries = append(s.summaries, summary)
+	sort.SliceStable(s.summaries, func(i, j int) bool {
+		return s.summaries[i].T.Before(s.summaries[j].T)
+	})
+	return true
+}
+
+// AddLog stores the parse in a log, returning false if it isn't a parse or is a repost
+func (s *ParseStore) AddLog(log EqLog) bool {
+	summary, ok := ParseSummaryLog(log)
+	if !ok {
+		return false
+	}
+	return s.Add(*summary)
+}
+
+// Save writes the store to Path
+func (s *ParseStore) Save() error {
+	return writeFileAtomic(s.Path, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(s.summaries)
+	})
+}
+
+// Summaries returns every stored parse in time order
+func (s *ParseStore) Summaries() []ParseSummary {
+	return s.summaries
+}
+
+// Between returns the parses posted between start and end, inclusive
+func (s *ParseStore) Between(start, end time.Time) []ParseSummary {
+	var results []ParseSummary
+	for _, summary := range s.summaries {
+		if !summary.T.Before(start) && !summary.T.After(end) {
+			results = append(results, summary)
+		}
+	}
+	return results
+}
+
+// PlayerHistory returns every stored result for a player in time order, for charting performance over weeks
+func (s *ParseStore) PlayerHistory(name string) []PlayerParse {
+	var history []PlayerParse
+	for _, summary := range s.summaries {
+		ranked := make([]ParsePlayer, len(summary.Players))
+		copy(ranked, summary.Players)
+		sort.SliceStable(ranked, func(i, j int) bool {
+			return ranked[i].Damage > ranked[j].Damage
+		})
+		for i, player := range ranked {
+			if !strings.EqualFold(player.Name, name) {
+				continue
+			}
+			history = append(history, PlayerParse{
+				T:        summary.T,
+				Mob:      summary.Mob,
+				Duration: summary.Duration,
+				Damage:   player.Damage,
+				DPS:      summary.DPS(player.Name),
+				Rank:     i + 1,
+				Players:  len(summary.Players),
+			})
+			break
+		}
+	}
+	return history
+}
@@ -0,0 +1,59 @@
+package everquest
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseSummaryLog(t *testing.T) {
+	msg := `Ravnor tells Von_parses:5, 'Lord Vyemm in 485s, 249k AH | Kaijin 22042 AH | Voltha 18485 AH | Patchouli 17664 AH | Silvaefar 17092 AH | Bunzz 17062 AH | Milliardo 15491 AH | Scylla 14543 AH | Vinadru 13840 AH | Porrt 13074 AH | Blossom 12927 AH | Impulse 12661 AH | Clearwater 10482 AH | Stony 9390 AH | Sacristan 8511 AH | Banis 7346 AH'`
+	start := time.Date(2021, time.January, 2, 20, 44, 8, 0, time.Local)
+	log := EqLog{T: start, Msg: msg, Channel: getChannel(msg), Source: getSource(msg)}
+	summary, ok := ParseSummaryLog(log)
+	if !ok {
+		t.Fatalf("Error reading parse from %s", msg)
+	}
+	if summary.Poster != "Ravnor" || summary.Channel != "Von_parses" || summary.Mob != "Lord Vyemm" || summary.Duration != 485*time.Second || summary.Total != 249000 || summary.Label != "AH" {
+		t.Fatalf("Error reading parse header: %+v", summary)
+	}
+	if len(summary.Players) != 15 || summary.Players[0] != (ParsePlayer{Name: "Kaijin", Damage: 22042}) || summary.Players[14] != (ParsePlayer{Name: "Banis", Damage: 7346}) {
+		t.Fatalf("Error reading parse players: %+v", summary.Players)
+	}
+	if dps := summary.DPS("voltha"); dps < 38.1 || dps > 38.2 {
+		t.Fatalf("Error working out dps: %f", dps)
+	}
+	if _, ok := ParseSummaryLog(EqLog{T: start, Msg: "You have entered The Plane of Knowledge."}); ok {
+		t.Fatalf("Error system message read as a parse")
+	}
+
+	store, err := OpenParseStore(filepath.Join(t.TempDir(), "parses.json"))
+	if err != nil {
+		t.Fatalf("Error opening store: %v", err)
+	}
+	if !store.AddLog(log) {
+		t.Fatalf("Error storing parse")
+	}
+	repost := log
+	repost.T = start.Add(2 * time.Minute)
+	repost.Msg = `Kaijin tells the guild, 'Lord Vyemm in 485s, 249k AH | Voltha 18485 AH | Kaijin 22042 AH | Patchouli 17664 AH | Silvaefar 17092 AH | Bunzz 17062 AH | Milliardo 15491 AH | Scylla 14543 AH | Vinadru 13840 AH | Porrt 13074 AH | Blossom 12927 AH | Impulse 12661 AH | Clearwater 10482 AH | Stony 9390 AH | Sacristan 8511 AH | Banis 7346 AH'`
+	if store.AddLog(repost) {
+		t.Fatalf("Error repost by another player in another channel was stored")
+	}
+	nextWeek := log
+	nextWeek.T = start.Add(7 * 24 * time.Hour)
+	if !store.AddLog(nextWeek) {
+		t.Fatalf("Error the same result a week later is a new fight")
+	}
+	if err := store.Save(); err != nil {
+		t.Fatalf("Error saving store: %v", err)
+	}
+	store, err = OpenParseStore(store.Path)
+	if err != nil || len(store.Summaries()) != 2 {
+		t.Fatalf("Error reopening store: %v", err)
+	}
+	history := store.PlayerHistory("Voltha")
+	if len(history) != 2 || history[0].Rank != 2 || history[0].Players != 15 || history[0].Damage != 18485 {
+		t.Fatalf("Error building player history: %+v", history)
+	}
+}
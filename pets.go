@@ -0,0 +1,112 @@
+package everquest
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	petLeaderRegex = regexp.MustCompile(`^My leader is (\w+)\.?$`)
+	petNameRegex   = regexp.MustCompile("^(\\w+)`s (?:warder|pet|familiar|ward|companion|minion)$")
+	petSummonRegex = regexp.MustCompile(`^(?:At your service,? Master|I live again)\.*$`) // what a pet tells its owner when summoned or revived
+)
+
+// PetTracker learns which pets belong to which players so pet damage can be counted under the owner
+type PetTracker struct {
+	Character string // Log owner, pets talking to You belong to them
+
+	pets map[string]knownPet // keyed by lower case pet name
+}
+
+type knownPet struct {
+	Name  string
+	Owner string
+}
+
+// NewPetTracker creates a tracker for the log of character
+func NewPetTracker(character string) *PetTracker {
+	return &PetTracker{Character: character, pets: make(map[string]knownPet)}
+}
+
+// Add learns from a log line, pets answering /pet leader name their owner and pets telling You something belong to the log owner.
+// A newly summoned pet replaces the log owner's previous pets since only one can be up at a time.
+func (t *PetTracker) Add(log EqLog) {
+	chat := ClassifyMessage(log.Msg)
+	switch chat.Channel {
+	case ChannelSay, ChannelNPC:
+		if m := petLeaderRegex.FindStringSubmatch(chat.Body); m != nil {
+			t.Learn(chat.Speaker, resolveYou(t.Character, m[1]))
+		}
+	case ChannelPet:
+		if t.Character == "" {
+			return
+		}
+		if petSummonRegex.MatchString(chat.Body) {
+			for _, pet := range t.Pets(t.Character) {
+				t.Forget(pet)
+			}
+		}
+		t.Learn(chat.Speaker, t.Character)
+	}
+}
+
+// AddEvent forgets pets as they die, use it alongside Add when logs are parsed elsewhere
+func (t *PetTracker) AddEvent(e Event) {
+	if death, ok := e.(*DeathEvent); ok {
+		t.Forget(death.Victim)
+	}
+}
+
+// Learn records that pet belongs to owner
+func (t *PetTracker) Learn(pet, owner string) {
+	if pet == "" || owner == "" || strings.EqualFold(pet, owner) {
+		return
+	}
+	if t.pets == nil {
+		t.pets = make(map[string]knownPet)
+	}
+	t.pets[strings.ToLower(pet)] = knownPet{Name: pet, Owner: owner}
+}
+
+// Forget drops what is known about a pet, ex: when it dies and the name may be reused
+func (t *PetTracker) Forget(pet string) {
+	delete(t.pets, strings.ToLower(pet))
+}
+
+// Known returns true if name is a learned pet
+func (t *PetTracker) Known(name string) bool {
+	_, ok := t.pets[strings.ToLower(name)]
+	return ok
+}
+
+// Owner returns the owner of a pet, from what has been learned or the Owner`s warder naming convention
+func (t *PetTracker) Owner(name string) (string, bool) {
+	if pet, ok := t.pets[strings.ToLower(name)]; ok {
+		return pet.Owner, true
+	}
+	if m := petNameRegex.FindStringSubmatch(name); m != nil && isPlayerName(m[1]) {
+		return resolveYou(t.Character, m[1]), true
+	}
+	return "", false
+}
+
+// Resolve returns the owner if name is a known pet, otherwise name itself
+func (t *PetTracker) Resolve(name string) string {
+	if owner, ok := t.Owner(name); ok {
+		return owner
+	}
+	return name
+}
+
+// Pets returns every learned pet belonging to owner
+func (t *PetTracker) Pets(owner string) []string {
+	var pets []string
+	for _, pet := range t.pets {
+		if strings.EqualFold(pet.Owner, owner) {
+			pets = append(pets, pet.Name)
+		}
+	}
+	sort.Strings(pets)
+	return pets
+}
@@ -0,0 +1,77 @@
+package everquest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPetTracker(t *testing.T) {
+	tracker := NewPetTracker("Voltha")
+	for _, msg := range []string{
+		"Gobaner says, 'My leader is Kaijin.'",
+		"Xabann says, 'My leader is You.'",
+		"Jobekn told you, 'At your service Master.'",
+	} {
+		tracker.Add(EqLog{Msg: msg})
+	}
+	if owner, ok := tracker.Owner("Gobaner"); !ok || owner != "Kaijin" {
+		t.Fatalf("Error learning pet from its leader: %s %v", owner, ok)
+	}
+	if pets := tracker.Pets("Voltha"); len(pets) != 1 || pets[0] != "Jobekn" {
+		t.Fatalf("Error replacing the log owner's pets on summon: %v", pets)
+	}
+	if owner := tracker.Resolve("Kaijin`s warder"); owner != "Kaijin" {
+		t.Fatalf("Error resolving pet by name: %s", owner)
+	}
+	if owner := tracker.Resolve("a gnoll`s pet"); owner != "a gnoll`s pet" {
+		t.Fatalf("Error resolving npc pet to an owner: %s", owner)
+	}
+
+	tracker.AddEvent(&DeathEvent{Victim: "Gobaner", Killer: "Lord Vyemm"})
+	if _, ok := tracker.Owner("Gobaner"); ok {
+		t.Fatalf("Error forgetting a dead pet")
+	}
+}
+
+func TestEncounterTrackerPets(t *testing.T) {
+	start := time.Date(2021, time.January, 2, 20, 0, 0, 0, time.Local)
+	lines := []struct {
+		offset int
+		msg    string
+	}{
+		{0, "Gobaner says, 'My leader is Kaijin.'"},
+		{1, "Gobaner bites Lord Vyemm for 100 points of damage."},
+		{2, "Kaijin slashes Lord Vyemm for 500 points of damage."},
+		{3, "Lord Vyemm hits Gobaner for 250 points of damage."},
+		{4, "Gobaner has been slain by Lord Vyemm!"},
+		{5, "Gobaner bites Lord Vyemm for 40 points of damage."},
+		{6, "Lord Vyemm has been slain by Kaijin!"},
+	}
+	tracker := NewEncounterTracker("Voltha")
+	tracker.Pets = NewPetTracker("Voltha")
+	for _, line := range lines {
+		tracker.Add(EqLog{T: start.Add(time.Duration(line.offset) * time.Second), Msg: line.msg})
+	}
+	tracker.Flush()
+
+	encounters := tracker.Encounters()
+	if len(encounters) != 1 {
+		t.Fatalf("Error ending the encounter on a pet death, got %d encounters", len(encounters))
+	}
+	vyemm := encounters[0]
+	if !vyemm.Killed || vyemm.Name() != "Lord Vyemm" {
+		t.Fatalf("Error tracking encounter: killed %v name %s", vyemm.Killed, vyemm.Name())
+	}
+	if kaijin := vyemm.Combatants["Kaijin"]; kaijin == nil || kaijin.Total != 600 {
+		t.Fatalf("Error rolling pet damage up under its owner: %+v", kaijin)
+	}
+	if vyemm.DamageTaken["Kaijin"] != 250 {
+		t.Fatalf("Error rolling damage taken by a pet up under its owner: %d", vyemm.DamageTaken["Kaijin"])
+	}
+	if gobaner := vyemm.Combatants["Gobaner"]; gobaner == nil || gobaner.Total != 40 {
+		t.Fatalf("Error forgetting a dead pet, a reused name kept its old owner: %+v", gobaner)
+	}
+	if !tracker.Friendly("Kaijin") {
+		t.Fatalf("Error marking a pet owner as a friend")
+	}
+}
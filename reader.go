@@ -0,0 +1,91 @@
+package everquest
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// LogReadOptions configures ReadLogContext
+type LogReadOptions struct {
+	FromStart bool           // Read the existing contents instead of starting at the end
+	PollRate  time.Duration  // How often to check for new lines at the end of the file, defaults to one second
+	OnError   func(error)    // Called for errors that do not stop reading such as unparseable lines, may be nil
+	Location  *time.Location // Zone the log was written in, nil for local time
+	Offset    int64          // Byte offset to resume reading from, used over FromStart when above 0
+	Progress  func(int64)    // Called with the offset just past each line once it has been handled, may be nil
+}
+
+// ReadLogContext tails the log at path, sending complete lines to out until ctx is done.
+// Lines are only emitted once their newline has been written, and rotation or truncation of the log is followed.
+// It returns nil when ctx is cancelled, otherwise the error that stopped reading.
+func ReadLogContext(ctx context.Context, path string, opts LogReadOptions, out chan<- EqLog) error {
+	pollRate := opts.PollRate
+	if pollRate <= 0 {
+		pollRate = time.Second
+	}
+	tailer := NewLogTailer(path, opts.FromStart, pollRate)
+	tailer.Resume = opts.Offset
+	defer tailer.Close()
+
+	reported := int64(-1)
+	progress := func() {
+		if opts.Progress != nil && tailer.started && tailer.Offset() != reported {
+			reported = tailer.Offset()
+			opts.Progress(reported)
+		}
+	}
+	parser := NewLogLineParser(opts.Location)
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		line, err := tailer.ReadLine()
+		if err == io.EOF || (tailer.started && os.IsNotExist(err)) {
+			progress()
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(pollRate):
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			progress()
+			continue
+		}
+		log, err := parser.Parse(line)
+		if err != nil {
+			if opts.OnError != nil {
+				opts.OnError(err)
+			}
+			progress()
+			continue
+		}
+		select {
+		case out <- *log:
+			progress()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// StartLogReader runs ReadLogContext in its own goroutine.
+// The log channel is closed once reading stops, and the error channel receives the error that stopped it, if any.
+func StartLogReader(ctx context.Context, path string, opts LogReadOptions) (<-chan EqLog, <-chan error) {
+	out := make(chan EqLog)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(out)
+		defer close(errs)
+		if err := ReadLogContext(ctx, path, opts, out); err != nil {
+			errs <- err
+		}
+	}()
+	return out, errs
+}
@@ -0,0 +1,75 @@
+package everquest
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Replayer plays a recorded log back as if it were being written live, for testing log consumers offline
+type Replayer struct {
+	Path     string         // Log to replay, .gz archives are decompressed
+	Speed    float64        // Playback speed, 1 for the original pace, 10 for ten times faster, 0 as fast as possible
+	Location *time.Location // Zone the log was written in, nil for local time
+}
+
+// NewReplayer creates a replayer for the log at path
+func NewReplayer(path string, speed float64) *Replayer {
+	return &Replayer{Path: path, Speed: speed}
+}
+
+// Replay sends every line of the log to out, waiting between lines as the original timestamps did divided by Speed.
+// It returns nil once the log is finished or ctx is cancelled, out is left open.
+func (r *Replayer) Replay(ctx context.Context, out chan<- EqLog) error {
+	reader, err := OpenArchiveFiles(r.Path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	reader.Location = r.Location
+
+	var first time.Time
+	start := time.Now()
+	for {
+		log, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if r.Speed > 0 {
+			if first.IsZero() {
+				first = log.T
+			}
+			due := start.Add(time.Duration(float64(log.T.Sub(first)) / r.Speed))
+			if wait := time.Until(due); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(wait):
+				}
+			}
+		}
+		select {
+		case out <- log:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// StartReplay runs Replay in its own goroutine.
+// The log channel is closed once the replay stops, and the error channel receives the error that stopped it, if any.
+func (r *Replayer) StartReplay(ctx context.Context) (<-chan EqLog, <-chan error) {
+	out := make(chan EqLog)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(out)
+		defer close(errs)
+		if err := r.Replay(ctx, out); err != nil {
+			errs <- err
+		}
+	}()
+	return out, errs
+}
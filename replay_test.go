@@ -0,0 +1,52 @@
+package everquest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReplayPacing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "eqlog_Mortimus_P1999Green.txt")
+	os.WriteFile(path, []byte("[Sat Jan 02 20:00:00 2021] one\n[Sat Jan 02 20:00:10 2021] two\n[Sat Jan 02 20:00:20 2021] three\n[Sat Jan 02 21:00:00 2021] an hour later\n"), 0644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	start := time.Now()
+	out, errs := NewReplayer(path, 100).StartReplay(ctx)
+	for i, want := range []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond} {
+		select {
+		case log := <-out:
+			elapsed := time.Since(start)
+			if elapsed < want-20*time.Millisecond || elapsed > want+500*time.Millisecond {
+				t.Fatalf("Error pacing line %d %s, sent after %s want %s", i, log.Msg, elapsed, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Error line %d never sent", i)
+		}
+	}
+	cancel() // the last line is 36 seconds away at this speed
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Fatalf("Error line sent after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Error replay ignored cancel while waiting")
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Error replaying: %v", err)
+	}
+
+	out, _ = NewReplayer(path, 0).StartReplay(context.Background())
+	start = time.Now()
+	var lines int
+	for range out {
+		lines++
+	}
+	if lines != 4 || time.Since(start) > time.Second {
+		t.Fatalf("Error replaying as fast as possible, %d lines in %s", lines, time.Since(start))
+	}
+}
@@ -0,0 +1,201 @@
+package everquest
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Roll is a completed /random, paired from its two log lines
+type Roll struct {
+	T      time.Time
+	Roller string
+	Min    int
+	Max    int
+	Result int
+}
+
+// SessionRoll is a roll collected by a RollSession along with anything wrong with it
+type SessionRoll struct {
+	Roll
+	Duplicate  bool // The roller already rolled in this session, only their first roll counts
+	OutOfRange bool // The roll used a different range than the session
+	NotInRaid  bool // The roller isn't in the session's raid
+}
+
+// Valid returns true if the roll counts towards the winner
+func (r *SessionRoll) Valid() bool {
+	return !r.Duplicate && !r.OutOfRange && !r.NotInRaid
+}
+
+// RollSession collects the rolls for one item, rolled in a range within a time window
+type RollSession struct {
+	Min    int
+	Max    int
+	Start  time.Time
+	Window time.Duration // How long rolls are accepted after Start, 0 for no limit
+	Raid   *Raid         // Rollers must be in this raid, nil allows anyone
+	Rolls  []SessionRoll
+}
+
+// NewRollSession starts collecting rolls from min to max at start for window, checking rollers against raid
+func NewRollSession(min, max int, start time.Time, window time.Duration, raid *Raid) *RollSession {
+	return &RollSession{Min: min, Max: max, Start: start, Window: window, Raid: raid}
+}
+
+// Open returns true if rolls made at t are accepted
+func (s *RollSession) Open(t time.Time) bool {
+	if t.Before(s.Start) {
+		return false
+	}
+	return s.Window <= 0 || !t.After(s.Start.Add(s.Window))
+}
+
+// Add collects a roll, returning false if it was made outside the window
+func (s *RollSession) Add(r Roll) bool {
+	if !s.Open(r.T) {
+		return false
+	}
+	roll := SessionRoll{Roll: r, OutOfRange: r.Min != s.Min || r.Max != s.Max}
+	for _, previous := range s.Rolls {
+		if strings.EqualFold(previous.Roller, r.Roller) && !previous.OutOfRange {
+			roll.Duplicate = true
+			break
+		}
+	}
+	if s.Raid != nil {
+		roll.NotInRaid = true
+		for _, member := range s.Raid.Members {
+			if strings.EqualFold(member.Player, r.Roller) {
+				roll.NotInRaid = false
+				break
+			}
+		}
+	}
+	s.Rolls = append(s.Rolls, roll)
+	return true
+}
+
+// Valid returns the rolls that count, highest first
+func (s *RollSession) Valid() []SessionRoll {
+	var valid []SessionRoll
+	for _, r := range s.Rolls {
+		if r.Valid() {
+			valid = append(valid, r)
+		}
+	}
+	sort.SliceStable(valid, func(i, j int) bool {
+		return valid[i].Result > valid[j].Result
+	})
+	return valid
+}
+
+// Winners returns the highest valid rolls, more than one when the top roll is tied
+func (s *RollSession) Winners() []SessionRoll {
+	valid := s.Valid()
+	if len(valid) == 0 {
+		return nil
+	}
+	var winners []SessionRoll
+	for _, r := range valid {
+		if r.Result != valid[0].Result {
+			break
+		}
+		winners = append(winners, r)
+	}
+	return winners
+}
+
+// Tied returns true if more than one roller shares the highest valid roll
+func (s *RollSession) Tied() bool {
+	return len(s.Winners()) > 1
+}
+
+// RollTracker pairs the two lines of every /random into rolls and hands them to the open sessions
+type RollTracker struct {
+	Raid     *Raid         // Roster given to sessions opened by the tracker, nil allows anyone
+	MaxDelay time.Duration // Longest gap between the two lines of a roll, defaults to 5 seconds
+	OnRoll   func(Roll)    // Called with every completed roll, may be nil
+	Parser   *EventParser  // Matchers used by Add, nil to share DefaultEventParser
+
+	pending  *DieRolledEvent
+	rolls    []Roll
+	sessions []*RollSession
+}
+
+// NewRollTracker creates a tracker checking rollers against raid
+func NewRollTracker(raid *Raid) *RollTracker {
+	return &RollTracker{
+		Raid:     raid,
+		MaxDelay: 5 * time.Second,
+	}
+}
+
+// Add parses a log, returning the roll if it completed one
+func (t *RollTracker) Add(log EqLog) (*Roll, bool) {
+	if e, ok := parseWith(t.Parser, log); ok {
+		return t.AddEvent(e)
+	}
+	return nil, false
+}
+
+// AddEvent pairs an already parsed event, returning the roll if it completed one
+func (t *RollTracker) AddEvent(e Event) (*Roll, bool) {
+	switch ev := e.(type) {
+	case *DieRolledEvent:
+		t.pending = ev
+	case *RollResultEvent:
+		rolled := t.pending
+		t.pending = nil
+		maxDelay := t.MaxDelay
+		if maxDelay <= 0 {
+			maxDelay = 5 * time.Second
+		}
+		if rolled == nil || ev.T.Sub(rolled.T) > maxDelay {
+			return nil, false
+		}
+		roll := Roll{T: rolled.T, Roller: rolled.Roller, Min: ev.Min, Max: ev.Max, Result: ev.Result}
+		t.rolls = append(t.rolls, roll)
+		t.route(roll)
+		if t.OnRoll != nil {
+			t.OnRoll(roll)
+		}
+		return &roll, true
+	}
+	return nil, false
+}
+
+// Rolls returns every completed roll in order
+func (t *RollTracker) Rolls() []Roll {
+	return t.rolls
+}
+
+// Open starts a session for rolls from min to max at start, collecting rolls for window
+func (t *RollTracker) Open(min, max int, start time.Time, window time.Duration) *RollSession {
+	s := NewRollSession(min, max, start, window, t.Raid)
+	t.sessions = append(t.sessions, s)
+	return s
+}
+
+// Sessions returns every session opened on the tracker
+func (t *RollTracker) Sessions() []*RollSession {
+	return t.sessions
+}
+
+// route gives a roll to the open session with the same range, or flags it as out of range when only one session is open
+func (t *RollTracker) route(r Roll) {
+	var open []*RollSession
+	for _, s := range t.sessions {
+		if !s.Open(r.T) {
+			continue
+		}
+		if s.Min == r.Min && s.Max == r.Max {
+			s.Add(r)
+			return
+		}
+		open = append(open, s)
+	}
+	if len(open) == 1 {
+		open[0].Add(r)
+	}
+}
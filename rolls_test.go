@@ -0,0 +1,70 @@
+package everquest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRollTracker(t *testing.T) {
+	raid := &Raid{Members: []RaidMember{{Player: "Kaijin"}, {Player: "Ryze"}, {Player: "Voltha"}}}
+	start := time.Date(2021, time.January, 2, 20, 0, 0, 0, time.Local)
+	tracker := NewRollTracker(raid)
+	session := tracker.Open(0, 100, start, time.Minute)
+	lines := []struct {
+		offset int
+		msg    string
+	}{
+		{1, "**A Magic Die is rolled by Kaijin."},
+		{1, "**It could have been any number from 0 to 100, but this time it turned up a 73."},
+		{2, "**A Magic Die is rolled by Ryze."},
+		{2, "**It could have been any number from 0 to 1000, but this time it turned up a 999."}, // out of range
+		{3, "**A Magic Die is rolled by Ryze."},
+		{3, "**It could have been any number from 0 to 100, but this time it turned up a 12."}, // a fixed range still counts
+		{4, "**A Magic Die is rolled by Kaijin."},
+		{4, "**It could have been any number from 0 to 100, but this time it turned up a 99."}, // duplicate
+		{5, "**A Magic Die is rolled by Destrod."},
+		{5, "**It could have been any number from 0 to 100, but this time it turned up a 100."}, // not in the raid
+		{6, "**A Magic Die is rolled by Voltha."},
+		{20, "**It could have been any number from 0 to 100, but this time it turned up a 80."}, // too long after the die
+		{30, "**A Magic Die is rolled by Voltha."},
+		{30, "**It could have been any number from 0 to 100, but this time it turned up a 73."},
+		{90, "**A Magic Die is rolled by Voltha."},
+		{90, "**It could have been any number from 0 to 100, but this time it turned up a 100."}, // session closed
+	}
+	var completed int
+	tracker.OnRoll = func(Roll) { completed++ }
+	for _, line := range lines {
+		tracker.Add(EqLog{T: start.Add(time.Duration(line.offset) * time.Second), Msg: line.msg})
+	}
+
+	if len(tracker.Rolls()) != 7 || completed != 7 {
+		t.Fatalf("Error pairing rolls, got %d called %d times", len(tracker.Rolls()), completed)
+	}
+	if len(session.Rolls) != 6 {
+		t.Fatalf("Error collecting session rolls, got %d", len(session.Rolls))
+	}
+	flags := []struct {
+		roller                      string
+		outOfRange, duplicate, raid bool
+	}{
+		{"Kaijin", false, false, true},
+		{"Ryze", true, false, true},
+		{"Ryze", false, false, true},
+		{"Kaijin", false, true, true},
+		{"Destrod", false, false, false},
+		{"Voltha", false, false, true},
+	}
+	for i, want := range flags {
+		got := session.Rolls[i]
+		if got.Roller != want.roller || got.OutOfRange != want.outOfRange || got.Duplicate != want.duplicate || got.NotInRaid == want.raid {
+			t.Fatalf("Error flagging roll %d: %+v", i, got)
+		}
+	}
+	winners := session.Winners()
+	if len(winners) != 2 || !session.Tied() || winners[0].Roller != "Kaijin" || winners[1].Roller != "Voltha" {
+		t.Fatalf("Error picking tied winners: %+v", winners)
+	}
+	if valid := session.Valid(); len(valid) != 3 || valid[2].Roller != "Ryze" {
+		t.Fatalf("Error ranking valid rolls: %+v", valid)
+	}
+}
@@ -1719,6 +1719,49 @@ func (s *Spell) ClassCanUse(class string) bool {
 	return false
 }
 
+// ClassLevel returns the level a class can first cast the spell at, 0 if the class cannot use it
+func (s *Spell) ClassLevel(class string) int {
+	var level int
+	switch class {
+	case "Bard":
+		level = s.Brdlevel
+	case "Beastlord":
+		level = s.Bstlevel
+	case "Berserker":
+		level = s.Berlevel
+	case "Cleric":
+		level = s.Clrlevel
+	case "Druid":
+		level = s.Drulevel
+	case "Enchanter":
+		level = s.Enclevel
+	case "Magician":
+		level = s.Maglevel
+	case "Monk":
+		level = s.Mnklevel
+	case "Necromancer":
+		level = s.Neclevel
+	case "Paladin":
+		level = s.Pallevel
+	case "Ranger":
+		level = s.Rnglevel
+	case "Rogue":
+		level = s.Roglevel
+	case "Shadow Knight":
+		level = s.Shdlevel
+	case "Shaman":
+		level = s.Shmlevel
+	case "Warrior":
+		level = s.Warlevel
+	case "Wizard":
+		level = s.Wizlevel
+	}
+	if level <= 0 || level >= 254 { // 254 and 255 mark classes that cannot use the spell
+		return 0
+	}
+	return level
+}
+
 func (db *SpellDB) GetClassSpells(class string) []Spell {
 	var results []Spell
 	for _, spell := range db.byID {
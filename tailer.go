@@ -0,0 +1,184 @@
+package everquest
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// LogTailer follows a log file by path, surviving rotation, truncation and re-creation of the file
+type LogTailer struct {
+	Path      string         // Path to the log file
+	FromStart bool           // Read the existing contents on first open instead of starting at the end
+	PollRate  time.Duration  // How long Tail waits at the end of the file before checking again
+	Location  *time.Location // Zone the log was written in, nil for local time
+	Resume    int64          // Byte offset to start at on first open, used over FromStart when above 0, see Offset
+
+	started bool // the file has been opened at least once, so re-opens start from the top
+	file    *os.File
+	info    os.FileInfo
+	reader  *bufio.Reader
+	offset  int64    // bytes consumed from the current file
+	partial string   // unterminated line waiting for the rest of its bytes
+	pending []string // complete lines drained from a rotated file
+}
+
+// NewLogTailer creates a tailer for path, the file is opened on the first read
+func NewLogTailer(path string, fromStart bool, pollRate time.Duration) *LogTailer {
+	return &LogTailer{
+		Path:      path,
+		FromStart: fromStart,
+		PollRate:  pollRate,
+	}
+}
+
+// ReadLine returns the next complete line without its line ending, io.EOF if no complete line is available yet
+func (t *LogTailer) ReadLine() (string, error) {
+	if len(t.pending) > 0 {
+		line := t.pending[0]
+		t.pending = t.pending[1:]
+		return line, nil
+	}
+	if t.file == nil {
+		if err := t.open(!t.FromStart && !t.started); err != nil {
+			return "", err
+		}
+	}
+	for {
+		str, err := t.reader.ReadString('\n')
+		t.offset += int64(len(str))
+		if err == nil {
+			line := t.partial + str
+			t.partial = ""
+			return strings.TrimRight(line, "\r\n"), nil
+		}
+		if err != io.EOF {
+			return "", err
+		}
+		t.partial += str
+		changed, err := t.checkFile()
+		if err != nil {
+			return "", err
+		}
+		if !changed {
+			return "", io.EOF
+		}
+		if len(t.pending) > 0 {
+			return t.ReadLine()
+		}
+	}
+}
+
+// Offset returns the byte offset just past the last complete line read from the current file, for resuming with Resume
+func (t *LogTailer) Offset() int64 {
+	return t.offset - int64(len(t.partial))
+}
+
+// Tail sends every new line of the log to out until something is sent on quit or the log cannot be read
+func (t *LogTailer) Tail(out chan EqLog, quit <-chan bool) error {
+	defer t.Close()
+	parser := NewLogLineParser(t.Location)
+	for {
+		line, err := t.ReadLine()
+		if err == io.EOF || (t.started && os.IsNotExist(err)) { // nothing new, or waiting on a rotated log to be re-created
+			select {
+			case <-quit:
+				return nil
+			case <-time.After(t.PollRate):
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if log, err := parser.Parse(line); err == nil {
+			out <- *log
+		}
+		select {
+		case <-quit:
+			return nil
+		default:
+		}
+	}
+}
+
+// Close releases the currently open file
+func (t *LogTailer) Close() error {
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
+
+func (t *LogTailer) open(atEnd bool) error {
+	file, err := os.Open(t.Path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	t.offset = 0
+	switch {
+	case !t.started && t.Resume > 0:
+		if t.Resume <= info.Size() { // a shorter file has been truncated since, so it is read from the top
+			t.offset, err = file.Seek(t.Resume, io.SeekStart)
+		}
+	case atEnd:
+		t.offset, err = file.Seek(0, io.SeekEnd)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	t.started = true
+	t.file = file
+	t.info = info
+	t.reader = bufio.NewReader(file)
+	return nil
+}
+
+// checkFile looks for the file at Path being replaced or truncated, returning true if reading should resume
+func (t *LogTailer) checkFile() (bool, error) {
+	info, err := os.Stat(t.Path)
+	if os.IsNotExist(err) { // rotated away and not yet re-created, keep waiting on the old handle
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !os.SameFile(t.info, info) {
+		// Drain whatever was written to the old file before it was replaced
+		rest, err := io.ReadAll(t.reader)
+		if err != nil {
+			return false, err
+		}
+		remaining := t.partial + string(rest)
+		t.partial = ""
+		for _, line := range strings.Split(remaining, "\n") {
+			line = strings.TrimRight(line, "\r")
+			if line != "" {
+				t.pending = append(t.pending, line)
+			}
+		}
+		t.Close()
+		return true, t.open(false)
+	}
+	if info.Size() < t.offset { // truncated in place, start over from the top
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		t.reader.Reset(t.file)
+		t.offset = 0
+		t.partial = ""
+		t.info = info
+		return true, nil
+	}
+	return false, nil
+}
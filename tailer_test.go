@@ -0,0 +1,135 @@
+package everquest
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readAvailable(t *testing.T, tailer *LogTailer) []string {
+	var lines []string
+	for {
+		line, err := tailer.ReadLine()
+		if err == io.EOF {
+			return lines
+		}
+		if err != nil {
+			t.Fatalf("Error reading tailed line: %v", err)
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestLogTailerRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "eqlog_Mortimus_aradune.txt")
+	os.WriteFile(path, []byte("line 1\nline 2\npart"), 0644)
+
+	tailer := NewLogTailer(path, true, 0)
+	defer tailer.Close()
+	if lines := readAvailable(t, tailer); len(lines) != 2 {
+		t.Fatalf("Error reading initial lines: %v", lines)
+	}
+
+	// finish the partial line, then rotate the file away and create a new one
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("ial 3\nline 4\n")
+	f.Close()
+	os.Rename(path, path+".old")
+	os.WriteFile(path, []byte("line 5\n"), 0644)
+
+	lines := readAvailable(t, tailer)
+	want := []string{"partial 3", "line 4", "line 5"}
+	if len(lines) != len(want) {
+		t.Fatalf("Error reading across rotation: %v", lines)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Fatalf("Error reading across rotation: %v", lines)
+		}
+	}
+}
+
+func TestLogTailerTruncation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "eqlog_Mortimus_aradune.txt")
+	os.WriteFile(path, []byte("line 1\nline 2\n"), 0644)
+
+	tailer := NewLogTailer(path, true, 0)
+	defer tailer.Close()
+	readAvailable(t, tailer)
+
+	os.WriteFile(path, []byte("new\n"), 0644)
+	lines := readAvailable(t, tailer)
+	if len(lines) != 1 || lines[0] != "new" {
+		t.Fatalf("Error reading after truncation: %v", lines)
+	}
+}
+
+func TestReadLogContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "eqlog_Mortimus_aradune.txt")
+	os.WriteFile(path, []byte("not a log line\n[Sat Jan 02 20:44:08 2021] You have entered The Plane of Knowledge.\n"), 0644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	badLines := make(chan error, 1)
+	opts := LogReadOptions{FromStart: true, PollRate: 10 * time.Millisecond, OnError: func(err error) { badLines <- err }}
+	logs, errs := StartLogReader(ctx, path, opts)
+
+	select {
+	case log := <-logs:
+		if log.Msg != "You have entered The Plane of Knowledge." {
+			t.Fatalf("Error reading log: %+v", log)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Error no log read")
+	}
+	select {
+	case <-badLines:
+	case <-time.After(time.Second):
+		t.Fatalf("Error bad line not passed to OnError")
+	}
+
+	cancel()
+	select {
+	case _, ok := <-logs:
+		if ok {
+			t.Fatalf("Error log read after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Error reader did not stop after cancel")
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Error cancelled reader returned %v", err)
+	}
+}
+
+func TestReadLogContextResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "eqlog_Mortimus_aradune.txt")
+	os.WriteFile(path, []byte("[Sat Jan 02 20:44:08 2021] first\n[Sat Jan 02 20:44:09 2021] second\n"), 0644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	offsets := make(chan int64, 10)
+	logs, _ := StartLogReader(ctx, path, LogReadOptions{FromStart: true, PollRate: 10 * time.Millisecond, Progress: func(offset int64) { offsets <- offset }})
+	<-logs
+	cancel()
+	offset := <-offsets
+	if offset != int64(len("[Sat Jan 02 20:44:08 2021] first\n")) {
+		t.Fatalf("Error reporting progress, got offset %d", offset)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	logs, _ = StartLogReader(ctx, path, LogReadOptions{Offset: offset, PollRate: 10 * time.Millisecond})
+	select {
+	case log := <-logs:
+		if log.Msg != "second" {
+			t.Fatalf("Error resuming from offset, got %s", log.Msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Error no log read after resuming")
+	}
+}
@@ -0,0 +1,77 @@
+package everquest
+
+// LogOwner is embedded in the trackers that follow one character's log.
+// It holds who You refers to and the parser their Add methods read lines with.
+type LogOwner struct {
+	Character string       // Log owner, replaces You in names
+	Parser    *EventParser // Matchers used by Add, nil to share DefaultEventParser
+}
+
+func (o *LogOwner) parse(log EqLog) (Event, bool) {
+	return parseWith(o.Parser, log)
+}
+
+func (o *LogOwner) resolveName(name string) string {
+	return resolveYou(o.Character, name)
+}
+
+// parseWith parses a log with parser, or the shared default parser when it is nil
+func parseWith(parser *EventParser, log EqLog) (Event, bool) {
+	if parser == nil {
+		parser = defaultParser
+	}
+	return parser.Parse(log)
+}
+
+// resolveYou replaces You with the character when it is known
+func resolveYou(character, name string) string {
+	if name == "You" && character != "" {
+		return character
+	}
+	return name
+}
+
+// EventDispatcher parses every log once and hands the result to any number of trackers,
+// instead of each tracker's Add matching the same line against every pattern again
+type EventDispatcher struct {
+	Parser *EventParser // Matchers used to parse, nil to share DefaultEventParser
+
+	logs   []func(EqLog)
+	events []func(Event)
+}
+
+// NewEventDispatcher creates a dispatcher with no handlers
+func NewEventDispatcher() *EventDispatcher {
+	return &EventDispatcher{}
+}
+
+// HandleLog adds a function called with every log before it is parsed, for trackers that also read chat ex: EncounterTracker.Observe
+func (d *EventDispatcher) HandleLog(f func(EqLog)) {
+	d.logs = append(d.logs, f)
+}
+
+// Handle adds a function called with every parsed event ex: HealTracker.AddEvent
+func (d *EventDispatcher) Handle(f func(Event)) {
+	d.events = append(d.events, f)
+}
+
+// Add parses a log once and hands it to every handler
+func (d *EventDispatcher) Add(log EqLog) {
+	for _, f := range d.logs {
+		f(log)
+	}
+	e, ok := parseWith(d.Parser, log)
+	if !ok {
+		return
+	}
+	for _, f := range d.events {
+		f(e)
+	}
+}
+
+// Run adds every log from in until it is closed
+func (d *EventDispatcher) Run(in <-chan EqLog) {
+	for log := range in {
+		d.Add(log)
+	}
+}
@@ -0,0 +1,717 @@
+package everquest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfigDuration is a time.Duration stored in config files as a string like "30s" or "2m"
+type ConfigDuration time.Duration
+
+// MarshalJSON writes the duration in time.Duration string form
+func (d ConfigDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON accepts either a duration string or a number of seconds
+func (d *ConfigDuration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		parsed, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*d = ConfigDuration(parsed)
+		return nil
+	}
+	var secs float64
+	if err := json.Unmarshal(b, &secs); err != nil {
+		return errors.New("duration must be a string like 30s or a number of seconds")
+	}
+	*d = ConfigDuration(secs * float64(time.Second))
+	return nil
+}
+
+// TriggerRule is a named pattern and the actions to run when a log line matches it
+type TriggerRule struct {
+	Name     string          `json:"name"`               // Unique rule name
+	Pattern  string          `json:"pattern"`            // Regex tested against the log message, may use capture groups
+	Group    string          `json:"group,omitempty"`    // Rules can be enabled or disabled together by group
+	Category string          `json:"category,omitempty"` // Free form category passed along to actions, ex: for choosing an overlay
+	Channels []string        `json:"channels,omitempty"` // Only match these channels, ex: guild, tell - empty matches all
+	Sources  []string        `json:"sources,omitempty"`  // Only match lines from these sources - empty matches all
+	Cooldown ConfigDuration  `json:"cooldown,omitempty"` // Minimum time between firings
+	Disabled bool            `json:"disabled,omitempty"` // Rule starts disabled
+	Actions  []ActionConfig  `json:"actions,omitempty"`  // Actions loaded from config
+	Handlers []TriggerAction `json:"-"`                  // Actions added in code, run after Actions
+
+	regex     *regexp.Regexp
+	built     []TriggerAction // actions created from Actions, closed with the rule
+	actions   []TriggerAction
+	lastFired time.Time
+}
+
+// ActionConfig describes an action in a rules file
+type ActionConfig struct {
+	Type     string         `json:"type"`                // file, callback, timer or webhook
+	Path     string         `json:"path,omitempty"`      // file: file to append Text to
+	Text     string         `json:"text,omitempty"`      // file, webhook, callback: text to write, see TriggerMatch.Expand
+	Name     string         `json:"name,omitempty"`      // callback: registered callback name, timer: timer name
+	URL      string         `json:"url,omitempty"`       // webhook: url to post to
+	Duration ConfigDuration `json:"duration,omitempty"`  // timer: how long the timer runs
+	Warning  ConfigDuration `json:"warning,omitempty"`   // timer: how long before the end to run OnWarning
+	OnWarn   []ActionConfig `json:"onWarning,omitempty"` // timer: actions run when the timer is about to end
+	OnEnd    []ActionConfig `json:"onEnd,omitempty"`     // timer: actions run when the timer ends
+}
+
+// TriggerMatch is handed to actions when a rule fires
+type TriggerMatch struct {
+	Rule      string            // Rule that fired
+	Category  string            // Category of the rule that fired
+	Character string            // Log owner, used for {C}
+	Log       EqLog             // Line that matched
+	Groups    []string          // Whole match followed by positional capture groups
+	Named     map[string]string // Named capture groups
+	Text      string            // Expanded text of a callback action configured with text
+}
+
+// Expand replaces {0}..{n} with capture groups, {name} with named groups, {C} with the character and {L} with the whole log message
+func (m TriggerMatch) Expand(text string) string {
+	return triggerTokenRegex.ReplaceAllStringFunc(text, func(token string) string {
+		key := token[1 : len(token)-1]
+		if i, err := strconv.Atoi(key); err == nil {
+			if i < len(m.Groups) {
+				return m.Groups[i]
+			}
+			return token
+		}
+		if val, ok := m.Named[key]; ok {
+			return val
+		}
+		switch key {
+		case "C", "c":
+			return m.Character
+		case "L", "l":
+			return m.Log.Msg
+		}
+		return token
+	})
+}
+
+var triggerTokenRegex = regexp.MustCompile(`\{\w+\}`)
+
+// TriggerAction is run when a rule fires
+type TriggerAction interface {
+	Fire(match TriggerMatch) error
+}
+
+// CallbackAction runs a go function when a rule fires
+type CallbackAction func(match TriggerMatch) error
+
+// Fire calls the callback
+func (f CallbackAction) Fire(match TriggerMatch) error {
+	return f(match)
+}
+
+// FileAction appends a line of text to a file when a rule fires
+type FileAction struct {
+	Path string // File to append to
+	Text string // Text to write, expanded with TriggerMatch.Expand, defaults to the log message
+}
+
+// Fire appends the expanded text to the file
+func (a *FileAction) Fire(match TriggerMatch) error {
+	file, err := os.OpenFile(a.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(expandOrMessage(a.Text, match) + "\n")
+	return err
+}
+
+// WebhookAction posts the text as json to a webhook url when a rule fires, discord style {"content": text}.
+// Posts are queued and sent in the background so a slow webhook never holds up the log being checked, Close stops the sender.
+type WebhookAction struct {
+	URL     string       // Webhook url
+	Text    string       // Text to post, expanded with TriggerMatch.Expand, defaults to the log message
+	Client  *http.Client // Client used to post, nil for one with a ten second timeout
+	OnError func(error)  // Called when a queued post fails, may be nil
+
+	mu     sync.Mutex
+	queue  chan string
+	done   chan struct{} // closed once the sender has stopped
+	closed bool
+}
+
+// webhookQueueSize is how many posts can wait on a slow webhook before new ones are dropped
+const webhookQueueSize = 64
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// Fire queues the post, returning an error only if the queue is full and the post was dropped
+func (a *WebhookAction) Fire(match TriggerMatch) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return fmt.Errorf("webhook %s is closed, dropped post", a.URL)
+	}
+	if a.queue == nil {
+		a.queue = make(chan string, webhookQueueSize)
+		a.done = make(chan struct{})
+		go a.send()
+	}
+	select {
+	case a.queue <- expandOrMessage(a.Text, match):
+		return nil
+	default:
+		return fmt.Errorf("webhook %s is falling behind, dropped post", a.URL)
+	}
+}
+
+// Post sends text to the webhook straight away
+func (a *WebhookAction) Post(text string) error {
+	body, err := json.Marshal(map[string]string{"content": text})
+	if err != nil {
+		return err
+	}
+	client := a.Client
+	if client == nil {
+		client = webhookClient
+	}
+	resp, err := client.Post(a.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned %s", a.URL, resp.Status)
+	}
+	return nil
+}
+
+// Close stops the background sender once the posts already queued have been sent, later posts are dropped
+func (a *WebhookAction) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	if a.queue != nil {
+		close(a.queue)
+	}
+	return nil
+}
+
+func (a *WebhookAction) send() {
+	defer close(a.done)
+	for text := range a.queue {
+		if err := a.Post(text); err != nil && a.OnError != nil {
+			a.OnError(err)
+		}
+	}
+}
+
+// TimerAction starts (or restarts) a named countdown on the engine when a rule fires
+type TimerAction struct {
+	Name      string          // Timer name, expanded with TriggerMatch.Expand, a running timer with the same name is restarted
+	Duration  time.Duration   // How long the timer runs
+	Warning   time.Duration   // How long before the end to run OnWarning, 0 to disable
+	OnWarning []TriggerAction // Actions run when the timer is about to end
+	OnEnd     []TriggerAction // Actions run when the timer ends
+
+	engine *TriggerEngine
+}
+
+// Close closes the actions run by the timer
+func (a *TimerAction) Close() error {
+	closeActions(a.OnWarning)
+	closeActions(a.OnEnd)
+	return nil
+}
+
+// Fire starts the timer
+func (a *TimerAction) Fire(match TriggerMatch) error {
+	if a.engine == nil {
+		return errors.New("timer " + a.Name + " is not attached to a trigger engine")
+	}
+	a.engine.startTimer(a, match)
+	return nil
+}
+
+// TriggerTimer is a running countdown started by a TimerAction
+type TriggerTimer struct {
+	Name     string        // Expanded timer name
+	Rule     string        // Rule that started the timer
+	Started  time.Time     // When the timer was started
+	Duration time.Duration // Total length of the timer
+
+	warn *time.Timer
+	end  *time.Timer
+}
+
+// Remaining returns how long is left on the timer at now
+func (t TriggerTimer) Remaining(now time.Time) time.Duration {
+	left := t.Started.Add(t.Duration).Sub(now)
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+// TriggerEngine checks log lines against rules and runs their actions, implementing LogAlert
+type TriggerEngine struct {
+	Character string      // Log owner name, used for {C} in patterns and text
+	OnError   func(error) // Called when an action fails, may be nil
+
+	mu             sync.Mutex
+	rules          []*TriggerRule
+	disabledGroups map[string]bool
+	callbacks      map[string]func(TriggerMatch) error
+	timers         map[string]*TriggerTimer
+}
+
+// NewTriggerEngine creates an empty trigger engine
+func NewTriggerEngine() *TriggerEngine {
+	return &TriggerEngine{
+		disabledGroups: make(map[string]bool),
+		callbacks:      make(map[string]func(TriggerMatch) error),
+		timers:         make(map[string]*TriggerTimer),
+	}
+}
+
+// RegisterCallback makes a go function available to rules files as a callback action
+func (e *TriggerEngine) RegisterCallback(name string, f func(TriggerMatch) error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.callbacks[name] = f
+}
+
+// AddRule compiles a rule and adds it to the engine
+func (e *TriggerEngine) AddRule(rule TriggerRule) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, existing := range e.rules {
+		if existing.Name == rule.Name {
+			return errors.New("trigger rule " + rule.Name + " already exists")
+		}
+	}
+	compiled, err := e.compileRule(rule)
+	if err != nil {
+		return err
+	}
+	e.rules = append(e.rules, compiled)
+	return nil
+}
+
+// ReplaceRules swaps every rule in the engine for rules, closing the actions of the old ones.
+// If any rule fails to compile the engine keeps its current rules.
+func (e *TriggerEngine) ReplaceRules(rules []TriggerRule) error {
+	e.mu.Lock()
+	var compiled []*TriggerRule
+	names := make(map[string]bool)
+	for _, rule := range rules {
+		if names[rule.Name] {
+			e.mu.Unlock()
+			closeRules(compiled)
+			return errors.New("trigger rule " + rule.Name + " already exists")
+		}
+		names[rule.Name] = true
+		c, err := e.compileRule(rule)
+		if err != nil {
+			e.mu.Unlock()
+			closeRules(compiled)
+			return err
+		}
+		compiled = append(compiled, c)
+	}
+	old := e.rules
+	e.rules = compiled
+	e.mu.Unlock()
+	closeRules(old)
+	return nil
+}
+
+// RemoveRule drops a rule from the engine, closing its actions
+func (e *TriggerEngine) RemoveRule(name string) error {
+	e.mu.Lock()
+	for i, rule := range e.rules {
+		if rule.Name == name {
+			e.rules = append(e.rules[:i], e.rules[i+1:]...)
+			e.mu.Unlock()
+			closeRules([]*TriggerRule{rule})
+			return nil
+		}
+	}
+	e.mu.Unlock()
+	return errors.New("cannot find trigger rule: " + name)
+}
+
+// Close stops every running timer and closes the actions of every rule, the engine has no rules afterwards
+func (e *TriggerEngine) Close() error {
+	e.mu.Lock()
+	for name, t := range e.timers {
+		t.stop()
+		delete(e.timers, name)
+	}
+	old := e.rules
+	e.rules = nil
+	e.mu.Unlock()
+	closeRules(old)
+	return nil
+}
+
+// compileRule compiles a rule's pattern and builds its actions, callers must hold e.mu
+func (e *TriggerEngine) compileRule(rule TriggerRule) (*TriggerRule, error) {
+	if rule.Name == "" {
+		return nil, errors.New("trigger rule needs a name")
+	}
+	pattern := strings.ReplaceAll(rule.Pattern, "{C}", regexp.QuoteMeta(e.Character))
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("trigger rule %s: %v", rule.Name, err)
+	}
+	rule.regex = r
+	actions, err := e.buildActions(rule.Actions)
+	if err != nil {
+		return nil, fmt.Errorf("trigger rule %s: %v", rule.Name, err)
+	}
+	rule.built = actions
+	rule.actions = append(actions[:len(actions):len(actions)], rule.Handlers...)
+	return &rule, nil
+}
+
+// LoadRulesFromFile adds every rule in a json rules file, either a list of rules or {"rules": [...]}
+func (e *TriggerEngine) LoadRulesFromFile(path string) error {
+	rules, err := readRulesFile(path)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if err := e.AddRule(rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReloadRulesFromFile replaces every rule in the engine with the rules in a json rules file, see ReplaceRules
+func (e *TriggerEngine) ReloadRulesFromFile(path string) error {
+	rules, err := readRulesFile(path)
+	if err != nil {
+		return err
+	}
+	return e.ReplaceRules(rules)
+}
+
+func readRulesFile(path string) ([]TriggerRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []TriggerRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		var file struct {
+			Rules []TriggerRule `json:"rules"`
+		}
+		if err2 := json.Unmarshal(data, &file); err2 != nil {
+			return nil, err
+		}
+		rules = file.Rules
+	}
+	return rules, nil
+}
+
+// Rules returns a copy of every rule in the engine
+func (e *TriggerEngine) Rules() []TriggerRule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var rules []TriggerRule
+	for _, rule := range e.rules {
+		rules = append(rules, *rule)
+	}
+	return rules
+}
+
+// EnableRule turns a single rule on
+func (e *TriggerEngine) EnableRule(name string) error {
+	return e.setRuleDisabled(name, false)
+}
+
+// DisableRule turns a single rule off
+func (e *TriggerEngine) DisableRule(name string) error {
+	return e.setRuleDisabled(name, true)
+}
+
+func (e *TriggerEngine) setRuleDisabled(name string, disabled bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, rule := range e.rules {
+		if rule.Name == name {
+			rule.Disabled = disabled
+			return nil
+		}
+	}
+	return errors.New("cannot find trigger rule: " + name)
+}
+
+// EnableGroup turns on every rule in a group that isn't individually disabled
+func (e *TriggerEngine) EnableGroup(group string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.disabledGroups, group)
+}
+
+// DisableGroup turns off every rule in a group
+func (e *TriggerEngine) DisableGroup(group string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.disabledGroups[group] = true
+}
+
+// Check implements LogAlert, the input may be a raw log line with timestamp or just the message
+func (e *TriggerEngine) Check(line string) {
+	log, err := ParseLogLine(line)
+	if err != nil {
+		log = &EqLog{
+			T:       time.Now(),
+			Msg:     line,
+			Channel: getChannel(line),
+			Source:  getSource(line),
+		}
+	}
+	e.CheckLog(*log)
+}
+
+// CheckLog runs every enabled rule against the log, returning the matches that fired
+func (e *TriggerEngine) CheckLog(log EqLog) []TriggerMatch {
+	now := log.T
+	if now.IsZero() {
+		now = time.Now()
+	}
+	type firing struct {
+		match   TriggerMatch
+		actions []TriggerAction
+	}
+	var fired []firing
+	e.mu.Lock()
+	for _, rule := range e.rules {
+		if rule.Disabled || e.disabledGroups[rule.Group] {
+			continue
+		}
+		if len(rule.Channels) > 0 && !containsFold(rule.Channels, log.Channel) {
+			continue
+		}
+		if len(rule.Sources) > 0 && !containsFold(rule.Sources, log.Source) {
+			continue
+		}
+		groups := rule.regex.FindStringSubmatch(log.Msg)
+		if groups == nil {
+			continue
+		}
+		if rule.Cooldown > 0 && !rule.lastFired.IsZero() && now.Sub(rule.lastFired) < time.Duration(rule.Cooldown) {
+			continue
+		}
+		rule.lastFired = now
+		match := TriggerMatch{
+			Rule:      rule.Name,
+			Category:  rule.Category,
+			Character: e.Character,
+			Log:       log,
+			Groups:    groups,
+			Named:     make(map[string]string),
+		}
+		for i, name := range rule.regex.SubexpNames() {
+			if name != "" {
+				match.Named[name] = groups[i]
+			}
+		}
+		fired = append(fired, firing{match: match, actions: rule.actions})
+	}
+	e.mu.Unlock()
+
+	// actions run outside the lock so they can use the engine
+	var matches []TriggerMatch
+	for _, f := range fired {
+		e.runActions(f.actions, f.match)
+		matches = append(matches, f.match)
+	}
+	return matches
+}
+
+// Timers returns every running timer
+func (e *TriggerEngine) Timers() []TriggerTimer {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var timers []TriggerTimer
+	for _, t := range e.timers {
+		timers = append(timers, *t)
+	}
+	return timers
+}
+
+// StopTimer cancels a running timer without running its end actions
+func (e *TriggerEngine) StopTimer(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if t, ok := e.timers[name]; ok {
+		t.stop()
+		delete(e.timers, name)
+	}
+}
+
+func (e *TriggerEngine) startTimer(a *TimerAction, match TriggerMatch) {
+	name := match.Expand(a.Name)
+	timer := &TriggerTimer{
+		Name:     name,
+		Rule:     match.Rule,
+		Started:  time.Now(),
+		Duration: a.Duration,
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if old, ok := e.timers[name]; ok {
+		old.stop()
+	}
+	e.timers[name] = timer
+	if a.Warning > 0 && a.Warning < a.Duration && len(a.OnWarning) > 0 {
+		timer.warn = time.AfterFunc(a.Duration-a.Warning, func() {
+			e.runActions(a.OnWarning, match)
+		})
+	}
+	timer.end = time.AfterFunc(a.Duration, func() {
+		e.mu.Lock()
+		if e.timers[name] == timer {
+			delete(e.timers, name)
+		}
+		e.mu.Unlock()
+		e.runActions(a.OnEnd, match)
+	})
+}
+
+func (t *TriggerTimer) stop() {
+	if t.warn != nil {
+		t.warn.Stop()
+	}
+	if t.end != nil {
+		t.end.Stop()
+	}
+}
+
+func (e *TriggerEngine) runActions(actions []TriggerAction, match TriggerMatch) {
+	for _, action := range actions {
+		if err := action.Fire(match); err != nil {
+			e.reportError(fmt.Errorf("trigger rule %s: %v", match.Rule, err))
+		}
+	}
+}
+
+func (e *TriggerEngine) reportError(err error) {
+	if e.OnError != nil {
+		e.OnError(err)
+	}
+}
+
+// buildActions converts configured actions to runnable ones, callers must hold e.mu
+func (e *TriggerEngine) buildActions(configs []ActionConfig) ([]TriggerAction, error) {
+	var actions []TriggerAction
+	for _, c := range configs {
+		switch c.Type {
+		case "file":
+			if c.Path == "" {
+				return nil, errors.New("file action needs a path")
+			}
+			actions = append(actions, &FileAction{Path: c.Path, Text: c.Text})
+		case "webhook":
+			if c.URL == "" {
+				return nil, errors.New("webhook action needs a url")
+			}
+			actions = append(actions, &WebhookAction{URL: c.URL, Text: c.Text, OnError: e.reportError})
+		case "callback":
+			f, ok := e.callbacks[c.Name]
+			if !ok {
+				return nil, errors.New("unknown callback " + c.Name)
+			}
+			if c.Text == "" {
+				actions = append(actions, CallbackAction(f))
+				continue
+			}
+			text := c.Text
+			actions = append(actions, CallbackAction(func(match TriggerMatch) error {
+				match.Text = match.Expand(text)
+				return f(match)
+			}))
+		case "timer":
+			if c.Duration <= 0 {
+				return nil, errors.New("timer action needs a duration")
+			}
+			onWarn, err := e.buildActions(c.OnWarn)
+			if err != nil {
+				return nil, err
+			}
+			onEnd, err := e.buildActions(c.OnEnd)
+			if err != nil {
+				return nil, err
+			}
+			actions = append(actions, e.NewTimerAction(c.Name, time.Duration(c.Duration), time.Duration(c.Warning), onWarn, onEnd))
+		default:
+			return nil, errors.New("unknown action type " + c.Type)
+		}
+	}
+	return actions, nil
+}
+
+// NewTimerAction creates a timer action that runs on this engine
+func (e *TriggerEngine) NewTimerAction(name string, duration, warning time.Duration, onWarning, onEnd []TriggerAction) *TimerAction {
+	return &TimerAction{
+		Name:      name,
+		Duration:  duration,
+		Warning:   warning,
+		OnWarning: onWarning,
+		OnEnd:     onEnd,
+		engine:    e,
+	}
+}
+
+// closeRules closes the actions the engine built for each rule, handlers added in code are left to their owners
+func closeRules(rules []*TriggerRule) {
+	for _, rule := range rules {
+		closeActions(rule.built)
+	}
+}
+
+// closeActions closes every action that holds resources, ex: a webhook's sender
+func closeActions(actions []TriggerAction) {
+	for _, action := range actions {
+		if c, ok := action.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+func expandOrMessage(text string, match TriggerMatch) string {
+	if text == "" {
+		return match.Log.Msg
+	}
+	return match.Expand(text)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
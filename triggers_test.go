@@ -0,0 +1,213 @@
+package everquest
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTriggerEngine(t *testing.T) {
+	engine := NewTriggerEngine()
+	engine.Character = "Mortimus"
+	var got []string
+	engine.RegisterCallback("record", func(m TriggerMatch) error {
+		got = append(got, m.Expand("{item} from {1}"))
+		return nil
+	})
+	rules := `{"rules": [{"name": "bids", "group": "dkp", "pattern": "^(\\w+) tells the guild, 'takings bids on (?P<item>.+?) pst", "channels": ["guild"], "cooldown": "1m", "actions": [{"type": "callback", "name": "record"}]}]}`
+	path := filepath.Join(t.TempDir(), "rules.json")
+	os.WriteFile(path, []byte(rules), 0644)
+	if err := engine.LoadRulesFromFile(path); err != nil {
+		t.Fatalf("Error loading rules: %v", err)
+	}
+	var _ LogAlert = engine
+
+	line := "[Sat Jan 02 20:44:08 2021] Destrod tells the guild, 'takings bids on Shawl of Perception pst bids close in 2mins'"
+	engine.Check(line)
+	engine.Check(line) // on cooldown
+	if len(got) != 1 || got[0] != "Shawl of Perception from Destrod" {
+		t.Fatalf("Error firing trigger: %v", got)
+	}
+
+	engine.CheckLog(EqLog{T: time.Date(2021, time.January, 2, 20, 50, 0, 0, time.Local), Msg: "Destrod tells the guild, 'takings bids on Cloak of Flames pst'", Channel: "guild", Source: "Destrod"})
+	if len(got) != 2 {
+		t.Fatalf("Error trigger did not fire after cooldown: %v", got)
+	}
+
+	engine.DisableGroup("dkp")
+	engine.CheckLog(EqLog{T: time.Date(2021, time.January, 2, 21, 0, 0, 0, time.Local), Msg: "Destrod tells the guild, 'takings bids on Cloak of Flames pst'", Channel: "guild", Source: "Destrod"})
+	if len(got) != 2 {
+		t.Fatalf("Error trigger fired while group disabled: %v", got)
+	}
+}
+
+func TestWebhookActionDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	posted := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		posted <- body["content"]
+	}))
+	defer server.Close()
+	defer close(release)
+
+	engine := NewTriggerEngine()
+	err := engine.AddRule(TriggerRule{Name: "zone", Pattern: "^You have entered (.+)\\.$", Actions: []ActionConfig{{Type: "webhook", URL: server.URL, Text: "zoned to {1}"}}})
+	if err != nil {
+		t.Fatalf("Error adding rule: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		engine.CheckLog(EqLog{T: time.Now(), Msg: "You have entered The Plane of Knowledge."})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Error CheckLog blocked on a stalled webhook")
+	}
+	release <- struct{}{}
+	select {
+	case content := <-posted:
+		if content != "zoned to The Plane of Knowledge" {
+			t.Fatalf("Error posting webhook content: %s", content)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Error webhook never posted")
+	}
+}
+
+func TestWebhookActionClose(t *testing.T) {
+	posted := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		posted <- body["content"]
+	}))
+	defer server.Close()
+
+	engine := NewTriggerEngine()
+	rule := TriggerRule{Name: "zone", Pattern: "^You have entered (.+)\\.$", Actions: []ActionConfig{{Type: "webhook", URL: server.URL, Text: "zoned to {1}"}}}
+	if err := engine.AddRule(rule); err != nil {
+		t.Fatalf("Error adding rule: %v", err)
+	}
+	webhook := engine.rules[0].built[0].(*WebhookAction)
+	engine.CheckLog(EqLog{T: time.Now(), Msg: "You have entered The Plane of Knowledge."})
+
+	if err := engine.ReplaceRules([]TriggerRule{rule, {Name: "zone", Pattern: "^x$"}}); err == nil {
+		t.Fatalf("Error replacing rules with a duplicate name")
+	}
+	if err := engine.ReplaceRules([]TriggerRule{rule}); err != nil {
+		t.Fatalf("Error replacing rules: %v", err)
+	}
+	select {
+	case <-webhook.done:
+	case <-time.After(time.Second):
+		t.Fatalf("Error replaced webhook's sender did not stop")
+	}
+	if content := <-posted; content != "zoned to The Plane of Knowledge" {
+		t.Fatalf("Error queued post not sent before closing: %s", content)
+	}
+	if err := webhook.Fire(TriggerMatch{}); err == nil {
+		t.Fatalf("Error closed webhook accepted a post")
+	}
+
+	webhook = engine.rules[0].built[0].(*WebhookAction)
+	engine.CheckLog(EqLog{T: time.Now(), Msg: "You have entered The Nexus."})
+	engine.Close()
+	select {
+	case <-webhook.done:
+	case <-time.After(time.Second):
+		t.Fatalf("Error webhook's sender did not stop when the engine closed")
+	}
+	if rules := engine.Rules(); len(rules) != 0 {
+		t.Fatalf("Error closed engine kept rules: %v", rules)
+	}
+}
+
+func TestImportGinaXML(t *testing.T) {
+	xml := `<SharedData><TriggerGroups><TriggerGroup><Name>Raid</Name><EnableByDefault>True</EnableByDefault><Triggers>
+<Trigger><Name>Help</Name><TriggerText>{S} tells you, 'help'</TriggerText><EnableRegex>False</EnableRegex><UseText>True</UseText><DisplayText>{S} needs help</DisplayText><UseTextToVoice>True</UseTextToVoice></Trigger>
+<Trigger><Name>Lookahead</Name><TriggerText>^(?=foo)bar</TriggerText><EnableRegex>True</EnableRegex></Trigger>
+<Trigger><Name>Slow</Name><TriggerText>^(?&lt;target&gt;.+) is slowed\.$</TriggerText><EnableRegex>True</EnableRegex><TimerType>Timer</TimerType><TimerName>Slow on {target}</TimerName><TimerMillisecondDuration>90000</TimerMillisecondDuration></Trigger>
+</Triggers></TriggerGroup></TriggerGroups></SharedData>`
+	imported, err := ImportGinaXML(strings.NewReader(xml))
+	if err != nil {
+		t.Fatalf("Error importing gina xml: %v", err)
+	}
+	if len(imported.Rules) != 2 || imported.Rules[0].Name != "Raid/Help" || imported.Rules[1].Actions[0].Type != "timer" {
+		t.Fatalf("Error converting gina triggers: %+v", imported.Rules)
+	}
+	want := []string{"Raid/Help: text to speech is not supported", "Raid/Lookahead: lookaround is not supported, skipped"}
+	if len(imported.Warnings) != len(want) {
+		t.Fatalf("Error warning about unsupported features: %v", imported.Warnings)
+	}
+	for i := range want {
+		if imported.Warnings[i] != want[i] {
+			t.Fatalf("Error warning about unsupported features: %v", imported.Warnings)
+		}
+	}
+
+	engine := NewTriggerEngine()
+	var shown []string
+	engine.RegisterCallback(GinaDisplayCallback, func(m TriggerMatch) error {
+		shown = append(shown, m.Text)
+		return nil
+	})
+	imported.AddTo(engine)
+	engine.CheckLog(EqLog{T: time.Now(), Msg: "Kaijin tells you, 'help'"})
+	if len(shown) != 1 || shown[0] != "Kaijin needs help" {
+		t.Fatalf("Error running imported trigger: %v", shown)
+	}
+}
+
+func writeGinaPackage(t *testing.T, path string, files map[string]string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Error creating gina package: %v", err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		entry, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("Error adding %s to gina package: %v", name, err)
+		}
+		entry.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Error writing gina package: %v", err)
+	}
+}
+
+func TestImportGinaPackage(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "raid.gtp")
+	writeGinaPackage(t, path, map[string]string{
+		"ShareData.xml": `<SharedData><TriggerGroups><TriggerGroup><Name>Raid</Name><Triggers>
+<Trigger><Name>Help</Name><TriggerText>{S} tells you, 'help'</TriggerText><UseText>True</UseText><DisplayText>{S} needs help</DisplayText></Trigger>
+</Triggers></TriggerGroup></TriggerGroups></SharedData>`,
+		"readme.txt": "not triggers",
+	})
+	imported, err := ImportGinaPackage(path)
+	if err != nil {
+		t.Fatalf("Error importing gina package: %v", err)
+	}
+	if len(imported.Rules) != 1 || imported.Rules[0].Name != "Raid/Help" || len(imported.Warnings) != 0 {
+		t.Fatalf("Error converting gina package: %+v %v", imported.Rules, imported.Warnings)
+	}
+
+	empty := filepath.Join(dir, "empty.gtp")
+	writeGinaPackage(t, empty, map[string]string{"readme.txt": "not triggers"})
+	if _, err := ImportGinaPackage(empty); err == nil || !strings.Contains(err.Error(), "no trigger xml found") {
+		t.Fatalf("Error importing gina package without xml: %v", err)
+	}
+}
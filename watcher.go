@@ -0,0 +1,134 @@
+package everquest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CharacterLog is an EqLog tagged with the character and server whose log it came from
+type CharacterLog struct {
+	EqLog
+	Player string // Character name from the log file name
+	Server string // Server name from the log file name
+}
+
+// LogWatcher tails every eqlog_Player_server.txt in an everquest Logs directory, including logs created after it starts
+type LogWatcher struct {
+	Dir      string         // Logs directory, ex: C:/Everquest/Logs
+	Options  LogReadOptions // Applied to every log, logs discovered after the first scan are always read from the start, Offset and Progress are managed per log
+	ScanRate time.Duration  // How often to look for new logs, defaults to ten seconds
+}
+
+// NewLogWatcher creates a watcher for the Logs directory under the everquest install at basePath
+func NewLogWatcher(basePath string, opts LogReadOptions) *LogWatcher {
+	return &LogWatcher{
+		Dir:      basePath + "/Logs",
+		Options:  opts,
+		ScanRate: 10 * time.Second,
+	}
+}
+
+// Watch tails all character logs concurrently, sending their lines to out until ctx is done.
+// Errors that stop a single log are passed to Options.OnError and the log is picked up again on the next scan, resuming after the last line sent.
+func (w *LogWatcher) Watch(ctx context.Context, out chan<- CharacterLog) error {
+	scanRate := w.ScanRate
+	if scanRate <= 0 {
+		scanRate = 10 * time.Second
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var mu sync.Mutex
+	active := make(map[string]bool)
+	offsets := make(map[string]int64) // offset just past the last line sent from each log, or where reading started
+	firstScan := true
+	for {
+		paths, err := filepath.Glob(filepath.Join(w.Dir, "eqlog_*_*.txt"))
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			player, server, err := ParseLogPath(path)
+			if err != nil {
+				continue
+			}
+			mu.Lock()
+			running := active[path]
+			offset, resume := offsets[path]
+			mu.Unlock()
+			if running {
+				continue
+			}
+			if !resume { // first time this log is read, settle where it starts so a restart before any line is sent picks up from there
+				offset, err = w.startOffset(path, firstScan)
+				if err != nil {
+					if w.Options.OnError != nil {
+						w.Options.OnError(err)
+					}
+					continue
+				}
+			}
+			opts := w.Options
+			opts.FromStart = true
+			opts.Offset = offset
+			mu.Lock()
+			active[path] = true
+			offsets[path] = offset
+			mu.Unlock()
+			logPath := path
+			opts.Progress = func(offset int64) {
+				mu.Lock()
+				offsets[logPath] = offset
+				mu.Unlock()
+			}
+			wg.Add(1)
+			go func(path, player, server string, opts LogReadOptions) {
+				defer wg.Done()
+				err := w.watchLog(ctx, path, player, server, opts, out)
+				if err != nil && w.Options.OnError != nil {
+					w.Options.OnError(err)
+				}
+				mu.Lock()
+				delete(active, path)
+				mu.Unlock()
+			}(path, player, server, opts)
+		}
+		firstScan = false
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(scanRate):
+		}
+	}
+}
+
+// startOffset returns where a log is first read from, the end of logs that already existed when the watcher started unless Options.FromStart is set
+func (w *LogWatcher) startOffset(path string, firstScan bool) (int64, error) {
+	if w.Options.FromStart || !firstScan { // logs created since we started have nothing in them that has been seen yet
+		return 0, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	if !info.Mode().IsRegular() { // nothing has been written to it as a log yet, ex: a directory in its place
+		return 0, nil
+	}
+	return info.Size(), nil
+}
+
+func (w *LogWatcher) watchLog(ctx context.Context, path, player, server string, opts LogReadOptions, out chan<- CharacterLog) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	logs, errs := StartLogReader(ctx, path, opts)
+	for log := range logs {
+		select {
+		case out <- CharacterLog{EqLog: log, Player: player, Server: server}:
+		case <-ctx.Done():
+		}
+	}
+	return <-errs
+}
@@ -0,0 +1,83 @@
+package everquest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func appendLog(t *testing.T, path, line string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Error opening log: %v", err)
+	}
+	defer f.Close()
+	f.WriteString(line + "\n")
+}
+
+func waitForLog(t *testing.T, out <-chan CharacterLog, msg string) CharacterLog {
+	select {
+	case log := <-out:
+		if log.Msg != msg {
+			t.Fatalf("Error expected %s but read %s", msg, log.Msg)
+		}
+		return log
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Error no log read with message %s", msg)
+	}
+	return CharacterLog{}
+}
+
+func TestLogWatcher(t *testing.T) {
+	dir := t.TempDir()
+	mortimus := filepath.Join(dir, "eqlog_Mortimus_aradune.txt")
+	appendLog(t, mortimus, "[Sat Jan 02 20:44:08 2021] before the watcher started")
+	kaijin := filepath.Join(dir, "eqlog_Kaijin_aradune.txt")
+	os.Mkdir(kaijin, 0755) // fails to read until it is replaced by a log
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 100)
+	w := &LogWatcher{
+		Dir:      dir,
+		Options:  LogReadOptions{PollRate: 10 * time.Millisecond, OnError: func(err error) { errs <- err }},
+		ScanRate: 10 * time.Millisecond,
+	}
+	out := make(chan CharacterLog)
+	done := make(chan error, 1)
+	go func() { done <- w.Watch(ctx, out) }()
+
+	select {
+	case <-errs:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Error unreadable log not passed to OnError")
+	}
+	os.Remove(kaijin)
+	appendLog(t, kaijin, "[Sat Jan 02 20:44:09 2021] written after the failure")
+	log := waitForLog(t, out, "written after the failure")
+	if log.Player != "Kaijin" || log.Server != "aradune" {
+		t.Fatalf("Error tagging restarted log: %+v", log)
+	}
+
+	time.Sleep(50 * time.Millisecond) // let the existing log reach its end
+	appendLog(t, mortimus, "[Sat Jan 02 20:44:10 2021] after the watcher started")
+	if log := waitForLog(t, out, "after the watcher started"); log.Player != "Mortimus" {
+		t.Fatalf("Error tagging log: %+v", log)
+	}
+
+	appendLog(t, filepath.Join(dir, "eqlog_Voltha_aradune.txt"), "[Sat Jan 02 20:44:11 2021] first line of a new log")
+	if log := waitForLog(t, out, "first line of a new log"); log.Player != "Voltha" || log.Server != "aradune" {
+		t.Fatalf("Error tagging new log: %+v", log)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Error cancelled watcher returned %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Error watcher did not stop after cancel")
+	}
+}
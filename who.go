@@ -0,0 +1,206 @@
+package everquest
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// classTitles maps every class title shown by /who to its class
+var classTitles = map[string]string{
+	"Bard": "Bard", "Minstrel": "Bard", "Troubadour": "Bard", "Virtuoso": "Bard", "Maestro": "Bard", "Performer": "Bard", "Jester": "Bard", "Rhapsodist": "Bard", "Harmonist": "Bard", "Lyricist": "Bard", "Composer": "Bard",
+	"Beastlord": "Beastlord", "Primalist": "Beastlord", "Animist": "Beastlord", "Savage Lord": "Beastlord", "Feral Lord": "Beastlord", "Wild Lord": "Beastlord", "Exarch": "Beastlord", "Visionary": "Beastlord", "Frostblood": "Beastlord", "Feral Master": "Beastlord",
+	"Berserker": "Berserker", "Brawler": "Berserker", "Vehement": "Berserker", "Rager": "Berserker", "Fury": "Berserker", "Ravager": "Berserker", "Sunderer": "Berserker", "Juggernaut": "Berserker", "Destroyer": "Berserker", "Titan": "Berserker",
+	"Cleric": "Cleric", "Vicar": "Cleric", "Templar": "Cleric", "High Priest": "Cleric", "Archon": "Cleric", "Prelate": "Cleric", "Exemplar": "Cleric", "Arch Priest": "Cleric", "Divine Hand": "Cleric",
+	"Druid": "Druid", "Wanderer": "Druid", "Preserver": "Druid", "Hierophant": "Druid", "Storm Warden": "Druid", "Natureguard": "Druid", "Nature Walker": "Druid", "Stormcaller": "Druid", "Wildfury": "Druid", "Arch Druid": "Druid",
+	"Enchanter": "Enchanter", "Illusionist": "Enchanter", "Beguiler": "Enchanter", "Phantasmist": "Enchanter", "Coercer": "Enchanter", "Bedazzler": "Enchanter", "Orator": "Enchanter", "Enthraller": "Enchanter", "Charlatan": "Enchanter",
+	"Magician": "Magician", "Elementalist": "Magician", "Conjurer": "Magician", "Arch Mage": "Magician", "Arch Convoker": "Magician", "Arch Magus": "Magician", "Grand Summoner": "Magician", "Elemental Lord": "Magician", "Arch Elementalist": "Magician", "Arch Invoker": "Magician",
+	"Monk": "Monk", "Disciple": "Monk", "Master": "Monk", "Grandmaster": "Monk", "Transcendent": "Monk", "Stone Fist": "Monk", "Ashenhand": "Monk", "Sensei": "Monk",
+	"Necromancer": "Necromancer", "Heretic": "Necromancer", "Defiler": "Necromancer", "Warlock": "Necromancer", "Arch Lich": "Necromancer", "Wraith": "Necromancer", "Dark Lord": "Necromancer", "Lich": "Necromancer", "Grand Lich": "Necromancer", "Dread Lich": "Necromancer",
+	"Paladin": "Paladin", "Cavalier": "Paladin", "Knight": "Paladin", "Crusader": "Paladin", "Lord Protector": "Paladin", "Holy Defender": "Paladin", "Sacred Sword": "Paladin",
+	"Ranger": "Ranger", "Pathfinder": "Ranger", "Outrider": "Ranger", "Warder": "Ranger", "Forest Stalker": "Ranger", "Plainswalker": "Ranger", "Huntmaster": "Ranger", "Frostwalker": "Ranger", "Hunter": "Ranger", "Traveler": "Ranger",
+	"Rogue": "Rogue", "Rake": "Rogue", "Blackguard": "Rogue", "Assassin": "Rogue", "Deceiver": "Rogue", "Nemesis": "Rogue", "Shadowblade": "Rogue", "Specter": "Rogue", "Silent Hand": "Rogue", "Shadowknife": "Rogue",
+	"Shadow Knight": "Shadow Knight", "Shadowknight": "Shadow Knight", "Reaver": "Shadow Knight", "Revenant": "Shadow Knight", "Grave Lord": "Shadow Knight", "Dread Lord": "Shadow Knight", "Scourge Knight": "Shadow Knight", "Bloodreaver": "Shadow Knight", "Corrupter": "Shadow Knight", "Doomknight": "Shadow Knight", "Dread Knight": "Shadow Knight",
+	"Shaman": "Shaman", "Mystic": "Shaman", "Prophet": "Shaman", "Luminary": "Shaman", "Oracle": "Shaman", "Soothsayer": "Shaman", "Spiritwatcher": "Shaman", "Truth Seeker": "Shaman", "Elder": "Shaman", "Spiritualist": "Shaman",
+	"Warrior": "Warrior", "Champion": "Warrior", "Myrmidon": "Warrior", "Warlord": "Warrior", "Overlord": "Warrior", "Vanquisher": "Warrior", "Imperator": "Warrior", "Bladesinger": "Warrior", "Gladiator": "Warrior", "Conqueror": "Warrior",
+	"Wizard": "Wizard", "Channeler": "Wizard", "Evoker": "Wizard", "Sorcerer": "Wizard", "Arcanist": "Wizard", "Grand Arcanist": "Wizard", "Elemental Master": "Wizard", "Pyromancer": "Wizard", "Thaumaturge": "Wizard", "Magus": "Wizard",
+}
+
+// ClassFromTitle returns the class a /who class title belongs to, ex: Grave Lord -> Shadow Knight
+func ClassFromTitle(title string) (string, bool) {
+	class, ok := classTitles[title]
+	return class, ok
+}
+
+// parseWhoEntry reads a /who player line ex: AFK [60 Grave Lord] Xibab (Iksar) <Guild> ZONE: potimea LFG
+func parseWhoEntry(log EqLog) Event {
+	e := &WhoEntryEvent{EqLog: log}
+	rest := strings.TrimSpace(log.Msg)
+	for !strings.HasPrefix(rest, "[") {
+		i := strings.IndexAny(rest, " [")
+		if i <= 0 {
+			return nil
+		}
+		e.setWhoFlag(rest[:i])
+		rest = strings.TrimSpace(rest[i:])
+	}
+	end := strings.IndexByte(rest, ']')
+	if end < 0 {
+		return nil
+	}
+	bracket := rest[1:end]
+	rest = strings.TrimSpace(rest[end+1:])
+	switch bracket {
+	case "ANONYMOUS":
+		e.Anonymous = true
+	case "ROLEPLAY":
+		e.Roleplay = true
+	default:
+		parts := strings.SplitN(bracket, " ", 2)
+		level, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) < 2 {
+			return nil
+		}
+		e.Level = level
+		e.Title = parts[1]
+		e.Class, _ = ClassFromTitle(e.Title)
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return nil
+	}
+	e.Name = fields[0]
+	rest = strings.TrimSpace(rest[len(fields[0]):])
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "("):
+			end := strings.IndexByte(rest, ')')
+			if end < 0 {
+				return e
+			}
+			e.Race = rest[1:end]
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "<"):
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				return e
+			}
+			if guild := rest[1:end]; guild == "LINKDEAD" {
+				e.LinkDead = true
+			} else {
+				e.Guild = guild
+			}
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "ZONE:"):
+			fields := strings.Fields(rest[len("ZONE:"):])
+			if len(fields) == 0 {
+				return e
+			}
+			e.Zone = fields[0]
+			rest = rest[strings.Index(rest, fields[0])+len(fields[0]):]
+		default:
+			i := strings.IndexByte(rest, ' ')
+			if i < 0 {
+				i = len(rest)
+			}
+			e.setWhoFlag(rest[:i])
+			rest = rest[i:]
+		}
+		rest = strings.TrimSpace(rest)
+	}
+	return e
+}
+
+func (e *WhoEntryEvent) setWhoFlag(flag string) {
+	switch flag {
+	case "AFK":
+		e.AFK = true
+	case "LFG":
+		e.LFG = true
+	case "<LINKDEAD>":
+		e.LinkDead = true
+	case "[ROLEPLAY]", "ROLEPLAY":
+		e.Roleplay = true
+	case "[ANONYMOUS]", "ANONYMOUS":
+		e.Anonymous = true
+	}
+}
+
+// WhoResult is a single /who command's output
+type WhoResult struct {
+	T         time.Time       // Time of the first line of output
+	Entries   []WhoEntryEvent // Every player listed
+	Count     int             // Player count from the footer, may be larger than Entries if the list was cut short
+	Zone      string          // Zone from the footer, EverQuest for a /who all
+	Truncated bool            // The server cut the list short
+}
+
+// Online returns the names of every listed player
+func (r *WhoResult) Online() []string {
+	var names []string
+	for _, entry := range r.Entries {
+		names = append(names, entry.Name)
+	}
+	return names
+}
+
+var (
+	whoHeaderRegex    = regexp.MustCompile(`^Players (?:on|in) EverQuest:$`)
+	whoSeparatorRegex = regexp.MustCompile(`^-+$`)
+	whoFooterRegex    = regexp.MustCompile(`^There (?:are|is) (\d+|no) players? in (.+?)\.$`)
+)
+
+// WhoParser groups consecutive /who output lines into WhoResults
+type WhoParser struct {
+	Parser   *EventParser    // Matchers used to read entries, nil to share DefaultEventParser
+	OnResult func(WhoResult) // Called with every completed result, may be nil
+
+	current *WhoResult
+}
+
+// NewWhoParser creates a /who parser
+func NewWhoParser() *WhoParser {
+	return &WhoParser{}
+}
+
+// Add reads a log line, returning the result once its footer is seen
+func (p *WhoParser) Add(log EqLog) (*WhoResult, bool) {
+	msg := strings.TrimSpace(log.Msg)
+	switch {
+	case whoHeaderRegex.MatchString(msg):
+		p.current = &WhoResult{T: log.T}
+		return nil, false
+	case whoSeparatorRegex.MatchString(msg):
+		return nil, false
+	case strings.HasPrefix(msg, "Your who request was cut short"):
+		p.start(log).Truncated = true
+		return nil, false
+	}
+	if m := whoFooterRegex.FindStringSubmatch(msg); m != nil {
+		result := p.start(log)
+		result.Count, _ = strconv.Atoi(m[1]) // "no players" leaves 0
+		result.Zone = m[2]
+		p.current = nil
+		if p.OnResult != nil {
+			p.OnResult(*result)
+		}
+		return result, true
+	}
+	if e, ok := parseWith(p.Parser, log); ok {
+		if entry, ok := e.(*WhoEntryEvent); ok {
+			result := p.start(log)
+			result.Entries = append(result.Entries, *entry)
+		}
+	}
+	return nil, false
+}
+
+// start returns the result in progress, beginning one if the header was missed
+func (p *WhoParser) start(log EqLog) *WhoResult {
+	if p.current == nil {
+		p.current = &WhoResult{T: log.T}
+	}
+	return p.current
+}
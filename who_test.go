@@ -0,0 +1,74 @@
+package everquest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWhoParser(t *testing.T) {
+	start := time.Date(2021, time.January, 2, 20, 0, 0, 0, time.Local)
+	lines := []string{
+		"Players on EverQuest:",
+		"---------------------------",
+		"[60 Grave Lord] Xibab (Iksar) <Ancient Blood> ZONE: potimea",
+		"AFK [65 Arch Convoker] Kaijin (Erudite) <Ancient Blood> LFG",
+		"[ANONYMOUS] Destrod  <Ancient Blood>",
+		" <LINKDEAD>[60 Templar] Ryze (High Elf)",
+		"There are 4 players in EverQuest.",
+		"Kaijin tells the guild, 'who is up?'",
+		"[50 Warlord] Mortimus (Barbarian)", // header scrolled off
+		"There is 1 player in Plane of Knowledge.",
+	}
+	var results []WhoResult
+	p := NewWhoParser()
+	p.OnResult = func(r WhoResult) { results = append(results, r) }
+	for i, line := range lines {
+		p.Add(EqLog{T: start.Add(time.Duration(i) * time.Second), Msg: line})
+	}
+	if len(results) != 2 {
+		t.Fatalf("Error grouping who output, got %d results", len(results))
+	}
+
+	all := results[0]
+	if !all.T.Equal(start) || all.Count != 4 || all.Zone != "EverQuest" || len(all.Entries) != 4 {
+		t.Fatalf("Error reading who result: %+v", all)
+	}
+	xibab := all.Entries[0]
+	if xibab.Level != 60 || xibab.Class != "Shadow Knight" || xibab.Race != "Iksar" || xibab.Guild != "Ancient Blood" || xibab.Zone != "potimea" {
+		t.Fatalf("Error reading who entry: %+v", xibab)
+	}
+	kaijin := all.Entries[1]
+	if !kaijin.AFK || !kaijin.LFG || kaijin.Class != "Magician" {
+		t.Fatalf("Error reading who flags: %+v", kaijin)
+	}
+	if destrod := all.Entries[2]; !destrod.Anonymous || destrod.Name != "Destrod" || destrod.Guild != "Ancient Blood" {
+		t.Fatalf("Error reading anonymous entry: %+v", destrod)
+	}
+	if ryze := all.Entries[3]; !ryze.LinkDead || ryze.Class != "Cleric" || ryze.Race != "High Elf" {
+		t.Fatalf("Error reading linkdead entry: %+v", ryze)
+	}
+
+	zone := results[1]
+	if !zone.T.Equal(start.Add(8*time.Second)) || zone.Count != 1 || zone.Zone != "Plane of Knowledge" || len(zone.Entries) != 1 || zone.Entries[0].Class != "Warrior" {
+		t.Fatalf("Error reading who result without header: %+v", zone)
+	}
+}
+
+func TestClassFromTitle(t *testing.T) {
+	titles := map[string]string{
+		"Grave Lord":    "Shadow Knight",
+		"Shadowknight":  "Shadow Knight",
+		"Arch Convoker": "Magician",
+		"Templar":       "Cleric",
+		"Warlord":       "Warrior",
+		"Wizard":        "Wizard",
+	}
+	for title, want := range titles {
+		if class, ok := ClassFromTitle(title); !ok || class != want {
+			t.Fatalf("Error reading class title %s, got %s want %s", title, class, want)
+		}
+	}
+	if _, ok := ClassFromTitle("Grand Poobah"); ok {
+		t.Fatalf("Error unknown class title was found")
+	}
+}
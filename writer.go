@@ -0,0 +1,257 @@
+package everquest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatLogLine is the inverse of ParseLogLine, formatting a log exactly as EverQuest writes it without the line ending
+// ex: [Sat Jan 02 20:44:08 2021] Destrod tells the guild, 'hello'
+func FormatLogLine(log EqLog) string {
+	return "[" + log.T.Format(EQLogTimeFormat) + "] " + log.Msg
+}
+
+// FormatEventMessage writes the message EverQuest logs for an event, built from the event's fields rather than its original line
+func FormatEventMessage(e Event) (string, error) {
+	switch ev := e.(type) {
+	case *MeleeHitEvent:
+		defender := ev.Defender
+		if defender == "You" {
+			defender = "YOU"
+		}
+		return fmt.Sprintf("%s %s %s for %d %s of damage.%s", ev.Attacker, ev.Verb, defender, ev.Damage, points(ev.Damage), modifiers(ev.Modifiers)), nil
+	case *SpellDamageEvent:
+		if ev.DamageType == "" || ev.Spell == "" {
+			return fmt.Sprintf("%s was hit by non-melee for %d %s of damage.", ev.Defender, ev.Damage, points(ev.Damage)), nil
+		}
+		return fmt.Sprintf("%s hit %s for %d %s of %s damage by %s.%s", ev.Attacker, lowerYou(ev.Defender), ev.Damage, points(ev.Damage), ev.DamageType, ev.Spell, modifiers(ev.Modifiers)), nil
+	case *DotDamageEvent:
+		if ev.Attacker == "You" {
+			return fmt.Sprintf("%s %s taken %d damage from your %s.%s", ev.Defender, have(ev.Defender), ev.Damage, ev.Spell, modifiers(ev.Modifiers)), nil
+		}
+		return fmt.Sprintf("%s %s taken %d damage from %s by %s.%s", ev.Defender, have(ev.Defender), ev.Damage, ev.Attacker, ev.Spell, modifiers(ev.Modifiers)), nil
+	case *HealEvent:
+		if ev.Healer == "" {
+			return fmt.Sprintf("You have been healed for %d %s.", ev.Amount, points(ev.Amount)), nil
+		}
+		target := lowerYou(ev.Target)
+		if ev.Target == "You" && ev.Healer == "You" {
+			target = "yourself"
+		}
+		msg := ev.Healer + " healed " + target
+		if ev.OverTime {
+			msg += " over time"
+		}
+		msg += " for " + strconv.Itoa(ev.Amount)
+		if ev.Full > 0 {
+			msg += " (" + strconv.Itoa(ev.Full) + ")"
+		}
+		msg += " hit " + points(ev.Amount)
+		if ev.Spell != "" {
+			msg += " by " + ev.Spell
+		}
+		return msg + "." + modifiers(ev.Modifiers), nil
+	case *LootEvent:
+		if ev.Giver != "" {
+			giver := ev.Giver
+			if giver == "master looter" {
+				giver = "the master looter"
+			}
+			return fmt.Sprintf("--%s %s been given %s by %s.--", ev.Looter, have(ev.Looter), countedItem(ev.Count, ev.Item), giver), nil
+		}
+		msg := fmt.Sprintf("--%s %s looted %s", ev.Looter, have(ev.Looter), countedItem(ev.Count, ev.Item))
+		if ev.Corpse != "" {
+			msg += " from " + ev.Corpse + "'s corpse"
+		}
+		return msg + ".--", nil
+	case *ZoneEvent:
+		return "You have entered " + ev.Zone + ".", nil
+	case *LevelEvent:
+		if ev.Lost {
+			return fmt.Sprintf("You have lost a level! Welcome to level %d.", ev.Level), nil
+		}
+		return fmt.Sprintf("You have gained a level! Welcome to level %d!", ev.Level), nil
+	case *ExperienceEvent:
+		msg := "You gain experience!!"
+		if ev.Share != "" {
+			msg = "You gain " + ev.Share + " experience!!"
+		}
+		if ev.Percent > 0 {
+			msg = strings.TrimSuffix(msg, "!") + " (" + strconv.FormatFloat(ev.Percent, 'f', -1, 64) + "%)"
+		}
+		return msg, nil
+	case *AAPointEvent:
+		msg := "You have gained an ability point!"
+		if ev.Points != 1 {
+			msg = fmt.Sprintf("You have gained %d ability points!", ev.Points)
+		}
+		if ev.Total > 0 {
+			msg += fmt.Sprintf("  You now have %d ability %s.", ev.Total, points(ev.Total))
+		}
+		return msg, nil
+	case *DeathEvent:
+		switch {
+		case ev.Killer == "":
+			return ev.Victim + " died.", nil
+		case ev.Killer == "You" && ev.Victim != "You":
+			return "You have slain " + ev.Victim + "!", nil
+		}
+		return fmt.Sprintf("%s %s been slain by %s!", ev.Victim, have(ev.Victim), ev.Killer), nil
+	case *TellEvent:
+		if ev.Outgoing {
+			return fmt.Sprintf("You told %s, '%s'", ev.To, ev.Text), nil
+		}
+		return fmt.Sprintf("%s tells you, '%s'", ev.From, ev.Text), nil
+	case *WhoEntryEvent:
+		return formatWhoEntry(ev), nil
+	case *DieRolledEvent:
+		return "**A Magic Die is rolled by " + ev.Roller + ".", nil
+	case *RollResultEvent:
+		return fmt.Sprintf("**It could have been any number from %d to %d, but this time it turned up a %d.", ev.Min, ev.Max, ev.Result), nil
+	case *SpellLandedEvent:
+		if ev.Target == "You" {
+			return strings.TrimSpace(ev.Spell.Castmsg3), nil
+		}
+		msg := strings.TrimRight(ev.Spell.Castmsg4, " ")
+		if msg != "" && msg[0] != ' ' && msg[0] != '\'' {
+			msg = " " + msg
+		}
+		return ev.Target + msg, nil
+	case *SpellFadedEvent:
+		return strings.TrimSpace(ev.Spell.Castmsg5), nil
+	}
+	return "", errors.New("cannot format event of type " + string(e.Type()))
+}
+
+// EventLog returns an event's log with the message rebuilt from the event's fields, keeping the original timestamp
+func EventLog(e Event) (EqLog, error) {
+	msg, err := FormatEventMessage(e)
+	if err != nil {
+		return EqLog{}, err
+	}
+	log := e.Line()
+	log.Msg = msg
+	log.Channel = getChannel(msg)
+	log.Source = getSource(msg)
+	return log, nil
+}
+
+func formatWhoEntry(e *WhoEntryEvent) string {
+	var parts []string
+	if e.AFK {
+		parts = append(parts, "AFK")
+	}
+	if e.LinkDead {
+		parts = append(parts, "<LINKDEAD>")
+	}
+	switch {
+	case e.Anonymous:
+		parts = append(parts, "[ANONYMOUS]")
+	case e.Roleplay:
+		parts = append(parts, "[ROLEPLAY]")
+	default:
+		parts = append(parts, "["+strconv.Itoa(e.Level)+" "+e.Title+"]")
+	}
+	parts = append(parts, e.Name)
+	if e.Race != "" {
+		parts = append(parts, "("+e.Race+")")
+	}
+	if e.Guild != "" {
+		parts = append(parts, "<"+e.Guild+">")
+	}
+	if e.Zone != "" {
+		parts = append(parts, "ZONE: "+e.Zone)
+	}
+	if e.LFG {
+		parts = append(parts, "LFG")
+	}
+	return strings.Join(parts, " ")
+}
+
+func points(n int) string {
+	if n == 1 {
+		return "point"
+	}
+	return "points"
+}
+
+func modifiers(m string) string {
+	if m == "" {
+		return ""
+	}
+	return " (" + m + ")"
+}
+
+func lowerYou(name string) string {
+	if name == "You" {
+		return "you"
+	}
+	return name
+}
+
+func have(name string) string {
+	if name == "You" {
+		return "have"
+	}
+	return "has"
+}
+
+// countedItem writes an item with its count or article ex: a Shawl of Perception, 3 Bone Chips
+func countedItem(count int, item string) string {
+	if count > 1 {
+		return strconv.Itoa(count) + " " + item
+	}
+	if item != "" && strings.ContainsAny(strings.ToLower(item[:1]), "aeiou") {
+		return "an " + item
+	}
+	return "a " + item
+}
+
+// LogWriter writes logs in the EverQuest log format, for fixtures, anonymized copies and filtered logs
+type LogWriter struct {
+	Location *time.Location // Zone timestamps are written in, nil keeps each log's own
+	LineEnd  string         // Written after every line, defaults to \n
+
+	w io.Writer
+}
+
+// NewLogWriter creates a writer to w
+func NewLogWriter(w io.Writer) *LogWriter {
+	return &LogWriter{LineEnd: "\n", w: w}
+}
+
+// WriteLog writes a single log line
+func (lw *LogWriter) WriteLog(log EqLog) error {
+	if lw.Location != nil {
+		log.T = log.T.In(lw.Location)
+	}
+	end := lw.LineEnd
+	if end == "" {
+		end = "\n"
+	}
+	_, err := io.WriteString(lw.w, FormatLogLine(log)+end)
+	return err
+}
+
+// WriteEvent writes an event's log line, the message rebuilt from the event's fields
+func (lw *LogWriter) WriteEvent(e Event) error {
+	log, err := EventLog(e)
+	if err != nil {
+		return err
+	}
+	return lw.WriteLog(log)
+}
+
+// Run writes every log from in until it is closed, returning the first error
+func (lw *LogWriter) Run(in <-chan EqLog) error {
+	for log := range in {
+		if err := lw.WriteLog(log); err != nil {
+			return err
+		}
+	}
+	return nil
+}